@@ -0,0 +1,132 @@
+package log
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Backpressure policy of an AsyncWriter with a full buffer
+type DropPolicy int
+
+const (
+	// Block the caller until there's room, no line is lost but logging may stall the caller
+	DropBlock DropPolicy = iota
+	// Drop the new line, the caller never waits but the most recent lines are lost
+	DropNewest
+	// Drop the oldest buffered line to make room, keeps recent lines at the cost of older ones
+	DropOldest
+)
+
+// AsyncWriter writes into the underlying writer in a background goroutine, so callers don't wait for slow writers
+type AsyncWriter struct {
+	// Lines dropped by the policy, first field to be 64-bit aligned for atomic access on 32-bit platforms
+	dropped uint64
+
+	writer io.Writer
+	policy DropPolicy
+	ch     chan []byte
+	done   chan struct{}
+
+	// Lines queued and not written yet, guarded by lock
+	queued int
+	idle   *sync.Cond
+	lock   sync.Mutex
+
+	// Whether the writer is closed, writes hold sendLock for reading while sending to ch so Close can't close it under them
+	closed   bool
+	sendLock sync.RWMutex
+}
+
+// Create an async writer buffering up to size writes with the drop policy
+func NewAsyncWriter(w io.Writer, size int, policy DropPolicy) *AsyncWriter {
+	a := &AsyncWriter{writer: w, policy: policy, ch: make(chan []byte, size), done: make(chan struct{})}
+	a.idle = sync.NewCond(&a.lock)
+	go a.run()
+	return a
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for p := range a.ch {
+		a.writer.Write(p)
+		a.release()
+	}
+}
+
+// Mark a queued write as written or dropped
+func (a *AsyncWriter) release() {
+	a.lock.Lock()
+	a.queued--
+	if a.queued == 0 {
+		a.idle.Broadcast()
+	}
+	a.lock.Unlock()
+}
+
+// Implement io.Writer interface, errors of the underlying writer are not reported.
+// Writes after Close fail with io.ErrClosedPipe.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.sendLock.RLock()
+	defer a.sendLock.RUnlock()
+	if a.closed {
+		return 0, io.ErrClosedPipe
+	}
+	p = append([]byte(nil), p...)
+	a.lock.Lock()
+	a.queued++
+	a.lock.Unlock()
+	switch a.policy {
+	case DropNewest:
+		select {
+		case a.ch <- p:
+		default:
+			atomic.AddUint64(&a.dropped, 1)
+			a.release()
+		}
+	case DropOldest:
+		for sent := false; !sent; {
+			select {
+			case a.ch <- p:
+				sent = true
+			default:
+				select {
+				case <-a.ch:
+					atomic.AddUint64(&a.dropped, 1)
+					a.release()
+				default:
+				}
+			}
+		}
+	default:
+		a.ch <- p
+	}
+	return len(p), nil
+}
+
+// Count writes dropped by the drop policy
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Flush waits until the buffered writes are written
+func (a *AsyncWriter) Flush() error {
+	a.lock.Lock()
+	for a.queued > 0 {
+		a.idle.Wait()
+	}
+	a.lock.Unlock()
+	return nil
+}
+
+// Close writes the buffered writes and stops the background goroutine, the underlying writer is not closed
+func (a *AsyncWriter) Close() error {
+	a.sendLock.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.ch)
+	}
+	a.sendLock.Unlock()
+	<-a.done
+	return nil
+}
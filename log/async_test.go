@@ -0,0 +1,73 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Fill an async writer blocked by a slowWriter: one write in progress and a full buffer of 2
+func fillAsync(policy DropPolicy) (*AsyncWriter, *slowWriter) {
+	w := &slowWriter{release: make(chan bool)}
+	a := NewAsyncWriter(w, 2, policy)
+	a.Write([]byte("0\n"))
+	// Wait for the first write to be taken by the background goroutine
+	for len(a.ch) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	a.Write([]byte("1\n"))
+	a.Write([]byte("2\n"))
+	return a, w
+}
+
+func TestAsyncDropPolicy(t *testing.T) {
+	a, w := fillAsync(DropNewest)
+	a.Write([]byte("3\n"))
+	close(w.release)
+	a.Close()
+	if out := w.String(); out != "0\n1\n2\n" || a.Dropped() != 1 {
+		t.Fatalf("unexpected output of drop newest %q, dropped %d", out, a.Dropped())
+	}
+
+	a, w = fillAsync(DropOldest)
+	a.Write([]byte("3\n"))
+	close(w.release)
+	a.Flush()
+	if out := w.String(); out != "0\n2\n3\n" || a.Dropped() != 1 {
+		t.Fatalf("unexpected output of drop oldest %q, dropped %d", out, a.Dropped())
+	}
+	a.Close()
+
+	a, w = fillAsync(DropBlock)
+	written := make(chan bool)
+	go func() {
+		a.Write([]byte("3\n"))
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatalf("expected the caller to block on a full buffer")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(w.release)
+	<-written
+	a.Close()
+	if out := w.String(); out != "0\n1\n2\n3\n" || a.Dropped() != 0 || strings.Count(out, "\n") != 4 {
+		t.Fatalf("unexpected output of block %q, dropped %d", out, a.Dropped())
+	}
+}
+
+func TestAsyncWriteAfterClose(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewAsyncWriter(&buf, 4, DropBlock)
+	a.Write([]byte("before\n"))
+	a.Close()
+	if n, err := a.Write([]byte("after\n")); n != 0 || err != io.ErrClosedPipe {
+		t.Fatalf("expected io.ErrClosedPipe after close, got %d %v", n, err)
+	}
+	if err := a.Close(); err != nil || buf.String() != "before\n" {
+		t.Fatalf("unexpected second close %v with output %q", err, buf.String())
+	}
+}
@@ -0,0 +1,57 @@
+package log
+
+// Audit writes an audit record with the fixed actor, action, resource and result fields followed by extra fields.
+// The record is a json line in any output format, bypassing the logger level, filter and WriteTimeout,
+// and the writer is flushed before Audit returns, see flushWriter. Fields listed in LogConfig.RedactKeys are masked.
+// Extra fields can not replace the fixed ones, colliding keys are namespaced as "fields.<key>" like in json lines.
+func (l *Logger) Audit(actor, action, resource, result string, extra ...interface{}) {
+	config := l.opts().config
+	redact := config != nil && len(config.RedactKeys) > 0
+	if redact {
+		extra = redactFields(config.RedactKeys, extra)
+	}
+	args := append([]interface{}{"actor", actor, "action", action, "resource", resource, "result", result}, auditFields(extra)...)
+	if redact {
+		args = redactFields(config.RedactKeys, args)
+	}
+	line := []byte(formatJSON(nil, "AUDIT", l.Clock(), "audit", args...))
+	o := l.sink()
+	o.Lock()
+	defer o.Unlock()
+	if crash := o.opts().crash; crash != nil {
+		crash.Write(line)
+	}
+	_, err := o.writer.Write(line)
+	if err == nil {
+		err = flushWriter(o.writer)
+	}
+	if err != nil {
+		o.lastError = err
+	}
+}
+
+// Namespace the extra fields of an audit record colliding with the fixed ones
+func auditFields(extra []interface{}) []interface{} {
+	names := make(map[string]bool, len(extra)/2)
+	for i := 0; i < len(extra); i += 2 {
+		names[FormatValue(extra[i])] = true
+	}
+	var fields []interface{}
+	for i := 0; i < len(extra); i += 2 {
+		switch name := FormatValue(extra[i]); name {
+		case "actor", "action", "resource", "result":
+			if fields == nil {
+				fields = append([]interface{}(nil), extra...)
+			}
+			for taken := true; taken; {
+				name = "fields." + name
+				taken = names[name]
+			}
+			fields[i] = name
+		}
+	}
+	if fields == nil {
+		return extra
+	}
+	return fields
+}
@@ -0,0 +1,45 @@
+package log
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	w := &flushSyncWriter{}
+	logger := NewLogger(&LogConfig{Level: ERROR})
+	logger.writer = w
+	logger.Audit("alice", "delete", "bucket/logs", "ok", "ip", "10.0.0.1")
+	if strings.Join(w.calls, ",") != "flush,sync" {
+		t.Fatalf("expected audit record flushed, got %q", w.calls)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(w.Bytes(), &record); err != nil {
+		t.Fatalf("invalid audit record %q: %v", w.String(), err)
+	}
+	for key, value := range map[string]string{"level": "AUDIT", "actor": "alice", "action": "delete", "resource": "bucket/logs", "result": "ok", "ip": "10.0.0.1"} {
+		if record[key] != value {
+			t.Fatalf("unexpected %s in audit record %q", key, w.String())
+		}
+	}
+	if record["time"] == nil {
+		t.Fatalf("expected time in audit record %q", w.String())
+	}
+}
+
+func TestAuditReservedKeys(t *testing.T) {
+	w := &flushSyncWriter{}
+	logger := NewLogger(nil)
+	logger.writer = w
+	logger.Audit("alice", "login", "db", "ok", "actor", "mallory", "level", "x", "fields.actor", "eve")
+	var record map[string]interface{}
+	if err := json.Unmarshal(w.Bytes(), &record); err != nil {
+		t.Fatalf("invalid audit record %q: %v", w.String(), err)
+	}
+	for key, value := range map[string]string{"level": "AUDIT", "actor": "alice", "fields.level": "x", "fields.actor": "eve", "fields.fields.actor": "mallory"} {
+		if record[key] != value {
+			t.Fatalf("unexpected %s in audit record %q", key, w.String())
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// BatchWriter coalesces small writes and forwards them to the underlying writer in batches.
+// A batch is flushed once it holds maxLines lines or maxBytes bytes, or maxLatency after its first write.
+type BatchWriter struct {
+	writer     io.Writer
+	maxBytes   int
+	maxLines   int
+	maxLatency time.Duration
+
+	buf   []byte
+	lines int
+	timer *time.Timer
+	sync.Mutex
+}
+
+// Create a batch writer, non-positive limits are ignored
+func NewBatchWriter(w io.Writer, maxBytes, maxLines int, maxLatency time.Duration) *BatchWriter {
+	return &BatchWriter{writer: w, maxBytes: maxBytes, maxLines: maxLines, maxLatency: maxLatency}
+}
+
+// Implement io.Writer interface, buffered bytes are written on flush
+func (b *BatchWriter) Write(p []byte) (n int, err error) {
+	b.Lock()
+	defer b.Unlock()
+	if len(b.buf) == 0 && b.maxLatency > 0 {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(b.maxLatency, func() { b.Flush() })
+		} else {
+			b.timer.Reset(b.maxLatency)
+		}
+	}
+	b.buf = append(b.buf, p...)
+	b.lines += bytes.Count(p, []byte{'\n'})
+	if (b.maxBytes > 0 && len(b.buf) >= b.maxBytes) || (b.maxLines > 0 && b.lines >= b.maxLines) {
+		err = b.flush()
+	}
+	return len(p), err
+}
+
+// Flush writes buffered bytes into the underlying writer
+func (b *BatchWriter) Flush() error {
+	b.Lock()
+	defer b.Unlock()
+	return b.flush()
+}
+
+func (b *BatchWriter) flush() (err error) {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	if len(b.buf) > 0 {
+		_, err = b.writer.Write(b.buf)
+		b.buf = b.buf[:0]
+		b.lines = 0
+	}
+	return
+}
+
+// Close flushes buffered bytes and closes the underlying writer if possible
+func (b *BatchWriter) Close() error {
+	b.Lock()
+	defer b.Unlock()
+	err := b.flush()
+	if closer, ok := b.writer.(io.Closer); ok {
+		if e := closer.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Batch collects the lines logged in a Logger.Batch call, it logs like the Logger it embeds
+type Batch struct {
+	*Logger
+	lines []batchLine
+}
+
+// Line collected by a batch with its level, level route and the lines of its sinks by output format
+type batchLine struct {
+	route  *levelRoute
+	level  Level
+	bytes  []byte
+	header bool // whether a TSV header is due before the line
+	sinks  map[OutputFormat][]byte
+}
+
+func (b *Batch) add(route *levelRoute, level Level, bytes []byte, header bool, sinks map[OutputFormat][]byte) {
+	b.lines = append(b.lines, batchLine{route: route, level: level, bytes: bytes, header: header, sinks: sinks})
+}
+
+// Batch collects the lines logged by fn with b and writes them under a single lock acquisition once fn returns,
+// so they are not interleaved with other lines. Each line is still written on its own, so record oriented writers
+// see whole lines, and a FileWriter holds off size rotation until the batch is written, rotating first if needed.
+// Loggers derived from b, e.g. with b.With or b.Named, log into the batch too, and so does a nested Batch call.
+// The lines of LogConfig.Sinks are written the same way after those of the logger writer.
+// Lines are not flushed one by one, the writers are flushed after the batch if any line is at or above LogConfig.FlushLevel.
+func (l *Logger) Batch(fn func(b *Batch)) {
+	if l.batch != nil {
+		fn(&Batch{Logger: l})
+		return
+	}
+	b := &Batch{Logger: l.derive()}
+	b.Logger.batch = b
+	fn(b)
+	if len(b.lines) == 0 {
+		return
+	}
+	o := l.sink()
+	o.Lock()
+	defer o.Unlock()
+	for _, w := range o.holdRotation(b.lines) {
+		defer w.releaseRotation()
+	}
+	var flush []*levelRoute
+	flushed := map[*levelRoute]bool{}
+	for _, line := range b.lines {
+		if route := line.route; route != nil {
+			if line.header && !route.headerWritten {
+				o.emitRoute(route, noLevel, []byte(TSVHeader))
+				route.headerWritten = true
+			}
+			o.emitRoute(route, line.level, line.bytes)
+		} else {
+			if line.header && !o.headerWritten {
+				o.emit(noLevel, []byte(TSVHeader))
+				o.headerWritten = true
+			}
+			o.emit(line.level, line.bytes)
+		}
+		if !flushed[line.route] && o.flushes(line.level) {
+			flush = append(flush, line.route)
+			flushed[line.route] = true
+		}
+	}
+	for _, line := range b.lines {
+		o.emitSinks(line.level, line.sinks)
+	}
+	if len(flush) > 0 {
+		o.flushRoutes(flush...)
+	}
+}
+
+// Hold off the rotation of the file writers the lines are written into, see FileWriter.holdRotation.
+// The caller must hold the writer lock and release the returned writers.
+func (l *Logger) holdRotation(lines []batchLine) (held []*FileWriter) {
+	sizes := make(map[*FileWriter]int)
+	for _, line := range lines {
+		w := l.writer
+		if line.route != nil {
+			w = line.route.writer
+		}
+		if fw, ok := w.(*FileWriter); ok {
+			if _, ok := sizes[fw]; !ok {
+				held = append(held, fw)
+			}
+			sizes[fw] += len(line.bytes)
+			if line.header {
+				sizes[fw] += len(TSVHeader)
+			}
+		}
+	}
+	for _, w := range held {
+		w.holdRotation(sizes[w])
+	}
+	return
+}
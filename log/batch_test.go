@@ -0,0 +1,147 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Writer recording each write call
+type recordWriter struct {
+	sync.Mutex
+	writes []string
+}
+
+func (w *recordWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func (w *recordWriter) calls() []string {
+	w.Lock()
+	defer w.Unlock()
+	return append([]string(nil), w.writes...)
+}
+
+func TestBatchWriter(t *testing.T) {
+	w := &recordWriter{}
+	b := NewBatchWriter(w, 0, 3, 20*time.Millisecond)
+	logger := NewLogger(nil)
+	logger.writer = b
+	logger.Output(INFO, "a")
+	logger.Output(INFO, "b")
+	if calls := w.calls(); len(calls) != 0 {
+		t.Fatalf("expected buffered lines, got %q", calls)
+	}
+	logger.Output(INFO, "c")
+	if calls := w.calls(); len(calls) != 1 || calls[0] != "a\nb\nc\n" {
+		t.Fatalf("expected one coalesced write, got %q", calls)
+	}
+
+	logger.Output(INFO, "d")
+	deadline := time.Now().Add(time.Second)
+	for len(w.calls()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if calls := w.calls(); len(calls) != 2 || calls[1] != "d\n" {
+		t.Fatalf("expected latency flush, got %q", calls)
+	}
+
+	b = NewBatchWriter(w, 4, 0, 0)
+	b.Write([]byte("xy"))
+	b.Write([]byte("z"))
+	if calls := w.calls(); len(calls) != 2 {
+		t.Fatalf("unexpected flush below max bytes %q", calls)
+	}
+	b.Close()
+	if calls := w.calls(); len(calls) != 3 || calls[2] != "xyz" {
+		t.Fatalf("expected flush on close, got %q", calls)
+	}
+}
+
+func benchmarkFileWriter(b *testing.B, batch bool) {
+	f, err := os.Create(b.TempDir() + "/bench.log")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	logger := NewLogger(nil)
+	logger.writer = f
+	if batch {
+		logger.writer = NewBatchWriter(f, 64<<10, 0, time.Second)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("Benchmark write", "i", i)
+	}
+}
+
+func BenchmarkBatchWriter(b *testing.B) { benchmarkFileWriter(b, true) }
+
+func BenchmarkUnbatchedWriter(b *testing.B) { benchmarkFileWriter(b, false) }
+
+func TestLoggerBatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "batch")
+	logger := NewLogger(&LogConfig{Path: path})
+	w := logger.writer.(*FileWriter)
+	defer w.Close()
+	w.maxSize = 100
+	logger.Output(INFO, strings.Repeat("x", 60))
+	logger.Batch(func(b *Batch) {
+		b.Info("first")
+		b.Output(INFO, "second")
+		b.Info("third")
+	})
+	archives, _ := filepath.Glob(path + ".log?*")
+	if len(archives) != 1 {
+		t.Fatalf("expected one archive, got %q", archives)
+	}
+	if data, _ := os.ReadFile(archives[0]); strings.Contains(string(data), "first") {
+		t.Fatalf("expected batch lines kept together, archive has %q", data)
+	}
+	data, _ := os.ReadFile(path + ".log")
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "first") || lines[1] != "second" || !strings.HasSuffix(lines[2], "third") {
+		t.Fatalf("unexpected log file content %q", data)
+	}
+}
+
+func TestLoggerBatchLines(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = NewFrameWriter(&buf)
+	logger.Batch(func(b *Batch) {
+		b.Info("one")
+		b.Info("two")
+	})
+	for _, suffix := range []string{"] one", "] two"} {
+		if frame, err := ReadFrame(&buf); err != nil || !strings.HasSuffix(string(frame), suffix) {
+			t.Fatalf("expected a frame of each line, got %q, err %v", frame, err)
+		}
+	}
+
+	w := &recordWriter{}
+	logger.writer = w
+	logger.Batch(func(b *Batch) {
+		b.With("a", 1).Info("with")
+		b.Named("db").Info("named")
+		b.Ctx(WithTraceID(context.Background(), "t1")).Info("ctx")
+		b.Batch(func(nested *Batch) { nested.Info("nested") })
+		if calls := w.calls(); len(calls) != 0 {
+			t.Fatalf("expected derived loggers to log into the batch, got %q", calls)
+		}
+		b.Info("last")
+	})
+	calls := w.calls()
+	if len(calls) != 5 || !strings.Contains(calls[0], "] with\ta=1") || !strings.Contains(calls[4], "] last") {
+		t.Fatalf("expected the lines of the batch in order, got %q", calls)
+	}
+}
@@ -0,0 +1,86 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File name suffix of log files compressed by the sweeper
+const CompressSuffix = ".gz"
+
+// Compress the rotated log files every CompressInterval until the writer is closed
+func (w *FileWriter) sweep() {
+	ticker := time.NewTicker(w.CompressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+		w.compressArchives()
+	}
+}
+
+// Compress the rotated log files which are not compressed nor in use yet
+func (w *FileWriter) compressArchives() {
+	base := filepath.Base(w.Path)
+	dir := filepath.Dir(w.Path)
+	list, err := w.fs().ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range list {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || name == base || !strings.HasPrefix(name, base) || strings.HasSuffix(name, CompressSuffix) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if w.InUse(path) {
+			continue
+		}
+		w.Acquire(path)
+		if err := w.compress(path); err != nil {
+			fmt.Printf("Failed to compress log file, path: %s err: %v \n", path, err)
+		}
+		w.Release(path)
+	}
+}
+
+// Gzip a log file into path+CompressSuffix and remove the original once done
+func (w *FileWriter) compress(path string) (err error) {
+	src, err := w.fs().OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	reader, ok := src.(io.Reader)
+	if !ok {
+		return fmt.Errorf("log file is not readable")
+	}
+	dst, err := w.fs().OpenFile(path+CompressSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0664)
+	if err != nil {
+		return
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, reader)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		w.fs().Remove(path + CompressSuffix)
+		return
+	}
+	return w.fs().Remove(path)
+}
@@ -0,0 +1,50 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressSweeper(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sweep")
+	logger := NewLogger(&LogConfig{Path: path, CompressInterval: 10 * time.Millisecond})
+	w := logger.writer.(*FileWriter)
+	defer w.Close()
+	logger.Info("archived")
+	if err := logger.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	var archives, plain []string
+	for i := 0; i < 100 && (len(archives) == 0 || len(plain) > 0); i++ {
+		time.Sleep(10 * time.Millisecond)
+		archives, _ = filepath.Glob(path + ".log?*" + CompressSuffix)
+		plain, _ = filepath.Glob(path + ".log?*[^z]")
+	}
+	if len(archives) != 1 {
+		t.Fatalf("expected one compressed archive, got %q", archives)
+	}
+	if len(plain) != 0 {
+		t.Fatalf("expected uncompressed archive removed, got %q", plain)
+	}
+	f, err := os.Open(archives[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(gz); !strings.Contains(string(data), "archived") {
+		t.Fatalf("unexpected archive content %q", data)
+	}
+	if data, _ := os.ReadFile(path + ".log"); len(data) != 0 {
+		t.Fatalf("expected main log file left alone, got %q", data)
+	}
+}
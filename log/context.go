@@ -0,0 +1,63 @@
+package log
+
+import (
+	"context"
+	"fmt"
+)
+
+type traceIDKey struct{}
+
+var (
+	// Context key of the trace ID, replace it to reuse the key set by an existing middleware
+	TraceIDContextKey interface{} = traceIDKey{}
+
+	// Field key of the trace ID in log lines
+	TraceIDFieldKey = "trace_id"
+)
+
+// Attach a trace ID to the context, usually done once by a HTTP middleware
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, TraceIDContextKey, id)
+}
+
+// Extract the trace ID from the context
+func TraceIDField(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	switch id := ctx.Value(TraceIDContextKey).(type) {
+	case string:
+		return id, id != ""
+	case fmt.Stringer:
+		return id.String(), true
+	default:
+		return "", false
+	}
+}
+
+// Ctx derives a logger tagging every structured line with the trace ID of the context, if any
+func (l *Logger) Ctx(ctx context.Context) *Logger {
+	id, ok := TraceIDField(ctx)
+	if !ok {
+		return l
+	}
+	return l.derive(TraceIDFieldKey, id)
+}
+
+// CtxFields derives a logger tagging every structured line with the values of the keys in the context, absent keys are skipped.
+// Field keys are the context keys formatted by FormatValue.
+func (l *Logger) CtxFields(ctx context.Context, keys ...interface{}) *Logger {
+	if ctx == nil {
+		return l
+	}
+	var fields []interface{}
+	for _, key := range keys {
+		if value := ctx.Value(key); value != nil {
+			fields = append(fields, FormatValue(key), value)
+		}
+	}
+	if len(fields) == 0 {
+		return l
+	}
+	return l.derive(fields...)
+}
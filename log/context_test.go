@@ -0,0 +1,43 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTraceID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	ctx := WithTraceID(context.Background(), "abc123")
+	if id, ok := TraceIDField(ctx); !ok || id != "abc123" {
+		t.Fatalf("unexpected trace id %q", id)
+	}
+	logger.Ctx(ctx).Info("handled", "status", 200)
+	logger.Ctx(context.Background()).Info("untraced")
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "] handled\ttrace_id=abc123\tstatus=200") || strings.Contains(lines[1], "trace_id") {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
+
+type tenantKey struct{}
+
+func (tenantKey) String() string { return "tenant" }
+
+func TestCtxFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	ctx := context.WithValue(context.Background(), "user", "bob")
+	ctx = context.WithValue(ctx, tenantKey{}, 42)
+	logger.CtxFields(ctx, "user", "missing", tenantKey{}).Info("served")
+	if out := buf.String(); !strings.HasSuffix(out, "] served\tuser=bob\ttenant=42\n") {
+		t.Fatalf("unexpected output %q", out)
+	}
+	if l := logger.CtxFields(ctx, "missing"); l != logger {
+		t.Fatalf("expected logger itself without present keys")
+	}
+}
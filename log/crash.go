@@ -0,0 +1,95 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Output of crash dumps written by Fatal and Recover, stderr by default since the main sink may be lost
+var CrashOutput io.Writer = os.Stderr
+
+// RingBuffer keeps the last size bytes written into it
+type RingBuffer struct {
+	buf  []byte
+	next int
+	full bool
+	sync.Mutex
+}
+
+// Create a ring buffer keeping the last size bytes
+func NewRingBuffer(size int) *RingBuffer {
+	return &RingBuffer{buf: make([]byte, size)}
+}
+
+// Implement io.Writer interface, overwriting the oldest bytes once full
+func (r *RingBuffer) Write(p []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	n := len(p)
+	if n >= len(r.buf) {
+		copy(r.buf, p[n-len(r.buf):])
+		r.next, r.full = 0, true
+		return n, nil
+	}
+	copied := copy(r.buf[r.next:], p)
+	if copied < n {
+		r.next = copy(r.buf, p[copied:])
+		r.full = true
+	} else {
+		r.next += copied
+		if r.next == len(r.buf) {
+			r.next, r.full = 0, true
+		}
+	}
+	return n, nil
+}
+
+// Get the kept bytes, oldest first
+func (r *RingBuffer) Bytes() []byte {
+	r.Lock()
+	defer r.Unlock()
+	if !r.full {
+		return append([]byte(nil), r.buf[:r.next]...)
+	}
+	return append(append([]byte(nil), r.buf[r.next:]...), r.buf[:r.next]...)
+}
+
+// Get the recent output kept by LogConfig.CrashBuffer, nil if not enabled
+func (l *Logger) CrashDump() []byte {
+	if crash := l.sink().opts().crash; crash != nil {
+		return crash.Bytes()
+	}
+	return nil
+}
+
+// Write the crash dump into CrashOutput if enabled
+func (l *Logger) dumpCrash() {
+	if dump := l.CrashDump(); len(dump) > 0 {
+		fmt.Fprintf(CrashOutput, "---- recent log output ----\n%s---- end of recent log output ----\n", dump)
+	}
+}
+
+// Recover logs a panic with stack info and the crash dump, to be deferred:
+//
+//	defer logger.Recover()
+func (l *Logger) Recover() {
+	if r := recover(); r != nil {
+		l.Output(ERROR, l.stackLine("PANIC", 9, "Recovered panic", "panic", r))
+		l.dumpCrash()
+	}
+}
+
+// Go runs fn in a goroutine which logs a panic of fn with Recover instead of crashing the process
+func (l *Logger) Go(fn func()) {
+	go func() {
+		defer l.Recover()
+		fn()
+	}()
+}
+
+// Go runs fn in a goroutine with panics logged by the Root logger, see Logger.Go
+func Go(fn func()) {
+	Root.Go(fn)
+}
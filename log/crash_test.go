@@ -0,0 +1,79 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRingBuffer(t *testing.T) {
+	r := NewRingBuffer(8)
+	r.Write([]byte("abc"))
+	if v := string(r.Bytes()); v != "abc" {
+		t.Fatalf("unexpected bytes %q", v)
+	}
+	r.Write([]byte("defgh"))
+	r.Write([]byte("ij"))
+	if v := string(r.Bytes()); v != "cdefghij" {
+		t.Fatalf("unexpected bytes after wrapping %q", v)
+	}
+	r.Write([]byte("0123456789"))
+	if v := string(r.Bytes()); v != "23456789" {
+		t.Fatalf("unexpected bytes after a big write %q", v)
+	}
+}
+
+func TestCrashDump(t *testing.T) {
+	var out, dump bytes.Buffer
+	CrashOutput = &dump
+	code := 0
+	exit = func(c int) { code = c }
+	defer func() {
+		CrashOutput = os.Stderr
+		exit = os.Exit
+	}()
+	logger := NewLogger(&LogConfig{CrashBuffer: 1 << 10})
+	logger.writer = &out
+	logger.Info("oldest")
+	for i := 0; i < 30; i++ {
+		logger.Info("filler", "i", i)
+	}
+	logger.Warn("recent line")
+	logger.Fatal("fatal error")
+	data := dump.String()
+	if code != 2 || !strings.Contains(data, "] recent line\n") || !strings.Contains(data, "fatal error") || strings.Contains(data, "oldest") {
+		t.Fatalf("unexpected crash dump %q", data)
+	}
+
+	dump.Reset()
+	out.Reset()
+	func() {
+		defer logger.Recover()
+		logger.Info("before panic")
+		panic("boom")
+	}()
+	if o := out.String(); !strings.Contains(o, "PANIC[") || !strings.Contains(o, "Recovered panic\tpanic=boom") || !strings.Contains(o, "TestCrashDump") {
+		t.Fatalf("unexpected recovered panic output %q", o)
+	}
+	if data := dump.String(); !strings.Contains(data, "] before panic\n") {
+		t.Fatalf("unexpected crash dump of panic %q", data)
+	}
+}
+
+func TestGo(t *testing.T) {
+	w := &recordWriter{}
+	logger := NewLogger(nil)
+	logger.writer = w
+	defer SetRootForTest(logger)()
+	Go(func() { panic("background boom") })
+	var out string
+	for i := 0; i < 100 && out == ""; i++ {
+		time.Sleep(5 * time.Millisecond)
+		out = strings.Join(w.calls(), "")
+	}
+	if !strings.Contains(out, "Recovered panic\tpanic=background boom") || !strings.Contains(out, "TestGo.func") {
+		t.Fatalf("expected panic logged with stack, got %q", out)
+	}
+}
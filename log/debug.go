@@ -0,0 +1,6 @@
+//go:build !nodebug
+
+package log
+
+// Whether TRACE and DEBUG fast path calls are compiled in, false with the nodebug build tag
+const debugEnabled = true
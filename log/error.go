@@ -0,0 +1,35 @@
+package log
+
+import "strings"
+
+// StructuredError carries key=value fields along with the error message
+type StructuredError struct {
+	Msg    string
+	Fields []interface{}
+}
+
+// Create a structured error with fields in key=value pairs
+func NewError(msg string, fields ...interface{}) *StructuredError {
+	return &StructuredError{Msg: msg, Fields: fields}
+}
+
+// Implement error interface with fields rendered in the log format
+func (e *StructuredError) Error() string {
+	return Format(e.Msg, e.Fields...)
+}
+
+// Render the message and fields as space separated logfmt values
+func (e *StructuredError) stringify() string {
+	var b strings.Builder
+	b.WriteString(escapeString(e.Msg))
+	count := len(e.Fields)
+	for i := 0; i < count; i += 2 {
+		b.WriteByte(' ')
+		b.WriteString(Stringify(e.Fields[i]))
+		b.WriteByte('=')
+		if i+1 < count {
+			b.WriteString(Stringify(e.Fields[i+1]))
+		}
+	}
+	return b.String()
+}
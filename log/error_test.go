@@ -0,0 +1,21 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStructuredError(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	err := NewError("read timeout", "op", "read", "path", "/tmp/a b")
+	logger.Error("Request failed", "err", err)
+	if out := buf.String(); !strings.HasSuffix(out, "] Request failed\terr=read timeout\top=read\tpath=/tmp/a b\n") {
+		t.Fatalf("unexpected output %q", out)
+	}
+	if str := Stringify(err); str != `"read timeout" op=read path="/tmp/a b"` {
+		t.Fatalf("unexpected stringified error %q", str)
+	}
+}
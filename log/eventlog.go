@@ -0,0 +1,58 @@
+package log
+
+import (
+	"io"
+	"strings"
+)
+
+// Windows event types of log lines
+const (
+	eventError       = 0x0001
+	eventWarning     = 0x0002
+	eventInformation = 0x0004
+)
+
+// LevelWriter is implemented by writers reporting lines by level, e.g. the Windows Event Log writer.
+// The logger writes its lines of a known level through WriteLevel, whatever the output format.
+type LevelWriter interface {
+	WriteLevel(level Level, p []byte) (int, error)
+}
+
+// Unknown level of bytes written by Logger.Write
+const noLevel Level = -1
+
+// Write bytes of the level into the writer, through WriteLevel if the writer is a LevelWriter
+func writeLevel(w io.Writer, level Level, p []byte) (int, error) {
+	if lw, ok := w.(LevelWriter); ok && level != noLevel {
+		return lw.WriteLevel(level, p)
+	}
+	return w.Write(p)
+}
+
+// Map a level to a Windows event type, levels from ERROR on including registered ones are errors
+func levelEventType(level Level) uint16 {
+	switch {
+	case level >= ERROR:
+		return eventError
+	case level == WARN:
+		return eventWarning
+	default:
+		return eventInformation
+	}
+}
+
+// Map a rendered log line of unknown level to a Windows event type by its leading level token
+func eventType(line []byte) uint16 {
+	if len(line) > 16 {
+		line = line[:16]
+	}
+	label := strings.TrimLeft(string(line), "[ ")
+	switch {
+	case strings.HasPrefix(label, "ERROR"), strings.HasPrefix(label, "FATAL"), strings.HasPrefix(label, "PANIC"):
+		return eventError
+	case strings.HasPrefix(label, "WARN"):
+		return eventWarning
+	default:
+		return eventInformation
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package log
+
+import (
+	"errors"
+	"io"
+)
+
+// NewEventLogWriter is only supported on Windows
+func NewEventLogWriter(source string) (io.WriteCloser, error) {
+	return nil, errors.New("windows event log is not supported on this platform")
+}
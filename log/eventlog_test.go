@@ -0,0 +1,64 @@
+package log
+
+import "testing"
+
+func TestEventType(t *testing.T) {
+	cases := map[string]uint16{
+		"ERROR[21-03-04UTC05:06:07.000] failed\n": eventError,
+		"FATAL[21-03-04UTC05:06:07.000] fatal\n":  eventError,
+		"[WARN][21-03-04UTC05:06:07.000] warn\n":  eventWarning,
+		" INFO[21-03-04UTC05:06:07.000] info\n":   eventInformation,
+		"DEBUG[21-03-04UTC05:06:07.000] debug\n":  eventInformation,
+	}
+	for line, expected := range cases {
+		if v := eventType([]byte(line)); v != expected {
+			t.Fatalf("unexpected event type %d of %q", v, line)
+		}
+	}
+}
+
+// Writer recording the levels passed to WriteLevel
+type levelRecorder struct {
+	levels []Level
+	writes int
+}
+
+func (w *levelRecorder) Write(p []byte) (int, error) {
+	w.writes++
+	return len(p), nil
+}
+
+func (w *levelRecorder) WriteLevel(level Level, p []byte) (int, error) {
+	w.levels = append(w.levels, level)
+	return len(p), nil
+}
+
+func TestLevelWriter(t *testing.T) {
+	for _, format := range []OutputFormat{JSONFormat, TSVFormat, SyslogFormat} {
+		w := &levelRecorder{}
+		logger := NewLogger(&LogConfig{Format: format})
+		logger.writer = w
+		logger.Error("failed")
+		logger.Warn("warn")
+		logger.Batch(func(b *Batch) {
+			b.Info("info")
+			b.Error("failed")
+		})
+		logger.Write([]byte("raw"), true)
+		expected := []Level{ERROR, WARN, INFO, ERROR}
+		if len(w.levels) != len(expected) {
+			t.Fatalf("unexpected levels %v of format %d", w.levels, format)
+		}
+		for i, level := range expected {
+			if w.levels[i] != level {
+				t.Fatalf("unexpected levels %v of format %d", w.levels, format)
+			}
+		}
+		if format != TSVFormat && w.writes != 1 || format == TSVFormat && w.writes != 2 {
+			t.Fatalf("expected raw writes of unknown level through Write, got %d", w.writes)
+		}
+	}
+	if levelEventType(ERROR+1) != eventError || levelEventType(WARN) != eventWarning || levelEventType(INFO) != eventInformation {
+		t.Fatal("unexpected event types of levels")
+	}
+}
@@ -0,0 +1,83 @@
+//go:build windows
+
+package log
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32                  = syscall.NewLazyDLL("advapi32.dll")
+	procRegisterEventSource   = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+	procReportEvent           = advapi32.NewProc("ReportEventW")
+)
+
+// Writer reporting each log line as an event of the Windows Event Log
+type eventLogWriter struct {
+	handle uintptr
+	sync.Mutex
+}
+
+// NewEventLogWriter creates a writer reporting log lines to the Windows Event Log under the source,
+// ERROR and higher lines as Error events, WARN lines as Warning events and others as Information events.
+// The writer is a LevelWriter, so lines of any output format are typed by their level.
+func NewEventLogWriter(source string) (io.WriteCloser, error) {
+	name, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, err
+	}
+	handle, _, err := procRegisterEventSource.Call(0, uintptr(unsafe.Pointer(name)))
+	if handle == 0 {
+		return nil, err
+	}
+	return &eventLogWriter{handle: handle}, nil
+}
+
+// Implement io.Writer interface, each write is reported as one event typed by the leading level token of the line
+func (w *eventLogWriter) Write(p []byte) (int, error) {
+	return w.report(eventType(p), p)
+}
+
+// Implement LevelWriter interface, each write is reported as one event of the level
+func (w *eventLogWriter) WriteLevel(level Level, p []byte) (int, error) {
+	return w.report(levelEventType(level), p)
+}
+
+// Report bytes as one event of the type
+func (w *eventLogWriter) report(typ uint16, p []byte) (int, error) {
+	msg, err := syscall.UTF16PtrFromString(strings.TrimSuffix(strings.ReplaceAll(string(p), "\x00", ""), "\n"))
+	if err != nil {
+		return 0, err
+	}
+	w.Lock()
+	defer w.Unlock()
+	if w.handle == 0 {
+		return 0, syscall.EINVAL
+	}
+	strs := []*uint16{msg}
+	ok, _, err := procReportEvent.Call(w.handle, uintptr(typ), 0, 1, 0, 1, 0, uintptr(unsafe.Pointer(&strs[0])), 0)
+	if ok == 0 {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Deregister the event source
+func (w *eventLogWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.handle == 0 {
+		return nil
+	}
+	ok, _, err := procDeregisterEventSource.Call(w.handle)
+	w.handle = 0
+	if ok == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package log
+
+import "testing"
+
+func TestEventLogWriter(t *testing.T) {
+	w, err := NewEventLogWriter("devfans-log-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	logger := NewLogger(nil)
+	logger.writer = w
+	logger.Warn("event log test", "a", 1)
+	if err := logger.LastError(); err != nil {
+		t.Fatalf("failed to report event: %v", err)
+	}
+}
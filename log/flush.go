@@ -0,0 +1,75 @@
+package log
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// Writer buffering log lines in the application until flushed, e.g. BatchWriter
+type flusher interface {
+	Flush() error
+}
+
+// Writer buffered by the OS until synced, e.g. FileWriter
+type syncer interface {
+	Sync() error
+}
+
+// Flush a writer: Flush is called first to hand application buffers to the OS, then Sync to commit OS buffers,
+// whichever of them the writer implements. Errors of both are returned together. Stdout and stderr are not synced.
+func flushWriter(w io.Writer) error {
+	var errs []error
+	if f, ok := w.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if s, ok := w.(syncer); ok && w != os.Stdout && w != os.Stderr {
+		if err := s.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// Flush the writers of the logger, including its level routes and sinks, see flushWriter for the order of calls
+func (l *Logger) Flush() error {
+	o := l.sink()
+	o.Lock()
+	defer o.Unlock()
+	var errs []error
+	opts := o.opts()
+	writers := append([]io.Writer{o.writer}, routeWriters(opts.routes)...)
+	for _, w := range append(writers, sinkWriters(opts.config.sinks())...) {
+		if err := flushWriter(w); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// Errors returned together
+type multiError []error
+
+func (m multiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (m multiError) Unwrap() []error { return m }
+
+// Combine errors, nil if there's none
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return multiError(errs)
+	}
+}
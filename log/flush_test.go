@@ -0,0 +1,80 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Writer recording the order of Flush and Sync calls
+type flushSyncWriter struct {
+	bytes.Buffer
+	calls []string
+	err   error
+}
+
+func (w *flushSyncWriter) Flush() error { w.calls = append(w.calls, "flush"); return w.err }
+func (w *flushSyncWriter) Sync() error  { w.calls = append(w.calls, "sync"); return w.err }
+
+func TestFlushSyncOrder(t *testing.T) {
+	w := &flushSyncWriter{}
+	logger := NewLogger(nil)
+	logger.writer = w
+	if err := logger.Named("db").Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(w.calls, ",") != "flush,sync" {
+		t.Fatalf("unexpected call order %q", w.calls)
+	}
+
+	w.calls = nil
+	w.err = errors.New("disk gone")
+	err := logger.Flush()
+	if strings.Join(w.calls, ",") != "flush,sync" || err == nil || err.Error() != "disk gone; disk gone" {
+		t.Fatalf("expected errors of both calls, got %v after %q", err, w.calls)
+	}
+}
+
+func TestFlushLevel(t *testing.T) {
+	w := &flushSyncWriter{}
+	logger := NewLogger(&LogConfig{FlushLevel: ERROR})
+	logger.writer = w
+	logger.Info("buffered")
+	logger.Output(WARN, "buffered raw")
+	if len(w.calls) != 0 {
+		t.Fatalf("expected no flush below ERROR, got %q", w.calls)
+	}
+	logger.Error("failed")
+	if strings.Join(w.calls, ",") != "flush,sync" {
+		t.Fatalf("expected flush of ERROR line, got %q", w.calls)
+	}
+	w.calls = nil
+	logger.Named("db").Output(ERROR, "failed raw")
+	if strings.Join(w.calls, ",") != "flush,sync" {
+		t.Fatalf("expected flush of raw ERROR line, got %q", w.calls)
+	}
+}
+
+func TestFlushLevelBatch(t *testing.T) {
+	w := &flushSyncWriter{}
+	logger := NewLogger(&LogConfig{FlushLevel: ERROR})
+	logger.writer = w
+	logger.Batch(func(b *Batch) {
+		b.Info("buffered")
+		b.Warn("buffered")
+	})
+	if len(w.calls) != 0 {
+		t.Fatalf("expected no flush of batch below ERROR, got %q", w.calls)
+	}
+	logger.Batch(func(b *Batch) {
+		b.Error("failed")
+		if len(w.calls) != 0 {
+			t.Fatalf("expected no flush inside batch, got %q", w.calls)
+		}
+		b.Info("after")
+	})
+	if strings.Join(w.calls, ",") != "flush,sync" || !strings.HasSuffix(w.String(), "after\n") {
+		t.Fatalf("expected one flush after the batch write, got %q", w.calls)
+	}
+}
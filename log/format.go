@@ -1,15 +1,106 @@
 package log
 
 import (
+	"database/sql/driver"
+	"encoding"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"net"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// Output format of structured log lines
+type OutputFormat int
+
+const (
+	// Default human readable format: LEVEL[time] msg	key=value
+	TextFormat OutputFormat = iota
+	// Tab separated columns: time, level, msg, fields as key=value;key=value
+	TSVFormat
+	// One json object per line with time, level, msg and fields, groups as nested objects
+	JSONFormat
+	// RFC5424 syslog lines with fields as structured data
+	SyslogFormat
+)
+
+// Header line written once before the first TSV record
+const TSVHeader = "time\tlevel\tmsg\tfields\n"
+
+// Escape column separators inside TSV cells
+var tsvEscaper = strings.NewReplacer("\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// Escape column separators and the k=v;k=v delimiters inside the TSV fields cell
+var tsvFieldEscaper = strings.NewReplacer("\\", "\\\\", ";", "\\;", "=", "\\=", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// Render a log record as a TSV line
+func formatTSV(level, stamp string, msg string, args ...interface{}) string {
+	var b strings.Builder
+	b.WriteString(stamp)
+	b.WriteByte('\t')
+	b.WriteString(level)
+	b.WriteByte('\t')
+	b.WriteString(tsvEscaper.Replace(msg))
+	b.WriteByte('\t')
+	count := len(args)
+	for i := 0; i < count; i += 2 {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(tsvFieldEscaper.Replace(FormatValue(args[i])))
+		b.WriteByte('=')
+		if i+1 < count {
+			b.WriteString(tsvFieldEscaper.Replace(FormatValue(args[i+1])))
+		}
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// Max nesting depth of maps flattened into fields, deeper maps are formatted as values
+const maxFlattenDepth = 4
+
+// Flatten map[string]interface{} values of key=value pairs into key.sub=value pairs, sorted by sub keys
+func flattenMaps(args []interface{}) []interface{} {
+	found := false
+	for i := 1; i < len(args) && !found; i += 2 {
+		_, found = args[i].(map[string]interface{})
+	}
+	if !found {
+		return args
+	}
+	fields := make([]interface{}, 0, len(args)*2)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fields = append(fields, args[i])
+		} else {
+			fields = flattenField(fields, FormatValue(args[i]), args[i+1], 0)
+		}
+	}
+	return fields
+}
+
+func flattenField(fields []interface{}, key string, value interface{}, depth int) []interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok || depth >= maxFlattenDepth {
+		return append(fields, key, value)
+	}
+	keys := make([]string, 0, len(m))
+	for sub := range m {
+		keys = append(keys, sub)
+	}
+	sort.Strings(keys)
+	for _, sub := range keys {
+		fields = flattenField(fields, key+"."+sub, m[sub], depth+1)
+	}
+	return fields
+}
+
 type Hex interface {
 	Hex() string
 }
@@ -48,6 +139,8 @@ func (v *_Verbosify) String() string {
 	return string(bytes)
 }
 
+// SimpleFormat formats a value without quoting. Interfaces take precedence in the order of
+// driver.Valuer, fmt.Stringer, error and fmt.Formatter.
 func SimpleFormat(value interface{}) string {
 	if value == nil {
 		return "nil"
@@ -65,6 +158,12 @@ func SimpleFormat(value interface{}) string {
 		return hex.EncodeToString(v)
 	case *[]byte:
 		return hex.EncodeToString(*v)
+	case json.RawMessage:
+		return string(v)
+	case net.IP:
+		return v.String()
+	case *net.IPNet:
+		return v.String()
 	case *big.Int:
 		return formatLogfmtBigInt(v)
 	case big.Int:
@@ -74,17 +173,60 @@ func SimpleFormat(value interface{}) string {
 		// timeFormat doesn't have any escape characters, and escaping is
 		// expensive.
 		return v.Format(TimeFormat)
+	case driver.Valuer:
+		// sql.Null* types render as their value, or null if not valid
+		if val, ok := driverValue(v); ok {
+			return SimpleFormat(val)
+		}
+		return fmt.Sprintf("%+v", v)
 	case fmt.Stringer:
 		return v.String()
 	case error:
 		return v.Error()
+	case fmt.Formatter:
+		// Render with the custom %+v of the type deliberately
+		return fmt.Sprintf("%+v", v)
 	case Hex:
 		return v.Hex()
+	case encoding.TextMarshaler:
+		if text, err := v.MarshalText(); err == nil {
+			return string(text)
+		}
+		return fmt.Sprintf("%+v", v)
 	default:
+		if elem, ok := derefPointers(v); ok {
+			return SimpleFormat(elem)
+		}
+		if str, ok := formatArray(v, SimpleFormat); ok {
+			return str
+		}
 		return fmt.Sprintf("%+v", v)
 	}
 }
 
+// Format an array or a pointer to an array like slices, byte arrays like hashes in hex and other arrays element by element
+func formatArray(value interface{}, format func(interface{}) string) (string, bool) {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Array {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Array {
+		return "", false
+	}
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		data := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(data), v)
+		return hex.EncodeToString(data), true
+	}
+	items := make([]string, v.Len())
+	for i := range items {
+		items[i] = format(v.Index(i).Interface())
+	}
+	return "[" + strings.Join(items, " ") + "]", true
+}
+
+// Stringify formats a value quoting strings when needed. Interfaces take precedence in the order of
+// driver.Valuer, fmt.Stringer, error and fmt.Formatter.
 func Stringify(value interface{}) string {
 	if value == nil {
 		return "nil"
@@ -94,21 +236,62 @@ func Stringify(value interface{}) string {
 		return escapeString(v)
 	case *string:
 		return escapeString(*v)
+	case json.RawMessage:
+		// Raw json is passed through verbatim
+		return string(v)
+	case net.IP:
+		return v.String()
+	case *net.IPNet:
+		return v.String()
+	case driver.Valuer:
+		// sql.Null* types render as their value, or null if not valid
+		if val, ok := driverValue(v); ok {
+			return Stringify(val)
+		}
+		return stringify(value)
 	case fmt.Stringer:
 		return escapeString(v.String())
+	case *StructuredError:
+		return v.stringify()
 	case error:
 		return escapeString(v.Error())
+	case fmt.Formatter:
+		// Render with the custom %+v of the type deliberately
+		return escapeString(fmt.Sprintf("%+v", v))
 	case Hex:
 		return v.Hex()
 	case []byte:
 		return hex.EncodeToString(v)
 	case *[]byte:
 		return hex.EncodeToString(*v)
+	case encoding.TextMarshaler:
+		if text, err := v.MarshalText(); err == nil {
+			return escapeString(string(text))
+		}
+		return stringify(value)
 	default:
 		return stringify(value)
 	}
 }
 
+// Get the value of a driver.Valuer, a nil value is returned as null
+func driverValue(v driver.Valuer) (value interface{}, ok bool) {
+	defer func() {
+		// Value of a nil pointer receiver may panic
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	value, err := v.Value()
+	if err != nil {
+		return nil, false
+	}
+	if value == nil {
+		return json.RawMessage("null"), true
+	}
+	return value, true
+}
+
 // formatValue formats a value for serialization
 func stringify(value interface{}) string {
 	if value == nil {
@@ -130,42 +313,70 @@ func stringify(value interface{}) string {
 		}
 		return formatLogfmtBigInt(v)
 	}
+	// Fast path for plain primitives, formatShared's deferred recover is only needed for other types
+	if str, ok := formatPrimitive(value); ok {
+		return str
+	}
 	value = formatShared(value)
+	if str, ok := formatPrimitive(value); ok {
+		return str
+	}
+	if str, ok := formatArray(value, Stringify); ok {
+		return str
+	}
+	return escapeString(fmt.Sprintf("%+v", value))
+}
+
+// formatPrimitive formats bool, number and string values, ok is false for any other type
+func formatPrimitive(value interface{}) (str string, ok bool) {
 	switch v := value.(type) {
 	case bool:
-		return strconv.FormatBool(v)
+		return strconv.FormatBool(v), true
 	case float32:
-		return strconv.FormatFloat(float64(v), 'f', 3, 64)
+		return strconv.FormatFloat(float64(v), 'f', 3, 64), true
 	case float64:
-		return strconv.FormatFloat(v, 'f', 3, 64)
+		return strconv.FormatFloat(v, 'f', 3, 64), true
 	case int8:
-		return strconv.FormatInt(int64(v), 10)
+		return strconv.FormatInt(int64(v), 10), true
 	case uint8:
-		return strconv.FormatInt(int64(v), 10)
+		return strconv.FormatInt(int64(v), 10), true
 	case int16:
-		return strconv.FormatInt(int64(v), 10)
+		return strconv.FormatInt(int64(v), 10), true
 	case uint16:
-		return strconv.FormatInt(int64(v), 10)
+		return strconv.FormatInt(int64(v), 10), true
 	// Larger integers get thousands separators.
 	case int:
-		return FormatLogfmtInt64(int64(v))
+		return FormatLogfmtInt64(int64(v)), true
 	case int32:
-		return FormatLogfmtInt64(int64(v))
+		return FormatLogfmtInt64(int64(v)), true
 	case int64:
-		return FormatLogfmtInt64(v)
+		return FormatLogfmtInt64(v), true
 	case uint:
-		return FormatLogfmtUint64(uint64(v))
+		return FormatLogfmtUint64(uint64(v)), true
 	case uint32:
-		return FormatLogfmtUint64(uint64(v))
+		return FormatLogfmtUint64(uint64(v)), true
 	case uint64:
-		return FormatLogfmtUint64(v)
+		return FormatLogfmtUint64(v), true
 	case string:
-		return escapeString(v)
+		return escapeString(v), true
 	default:
-		return escapeString(fmt.Sprintf("%+v", value))
+		return "", false
 	}
 }
 
+// Separator between digit groups of large integers, e.g. '.' or ' ' in some locales.
+// It's not synchronized, set it before logging, through SetThousandsSep to validate it.
+var ThousandsSep byte = ','
+
+// SetThousandsSep sets the thousands separator, digits, signs, '=', control and non-ASCII bytes are rejected
+func SetThousandsSep(sep byte) error {
+	if sep < ' ' || sep > '~' || (sep >= '0' && sep <= '9') || sep == '-' || sep == '+' || sep == '=' {
+		return fmt.Errorf("invalid thousands separator %q", sep)
+	}
+	ThousandsSep = sep
+	return nil
+}
+
 // FormatLogfmtInt64 formats n with thousand separators.
 func FormatLogfmtInt64(n int64) string {
 	if n < 0 {
@@ -188,18 +399,26 @@ func formatLogfmtUint64(n uint64, neg bool) string {
 			return strconv.Itoa(int(n))
 		}
 	}
-	// Large numbers should be split
-	const maxLength = 26
+	// Large numbers should be split, into at most 20 digits of math.MaxUint64 with a separator every 3 digits,
+	// plus a sign of negative numbers, which are no longer than math.MinInt64
+	const (
+		maxDigits = 20
+		maxLength = maxDigits + (maxDigits-1)/3 + 1
+		// Fail to compile if maxLength can not hold the longest outputs
+		_ = uint(maxLength - len("18,446,744,073,709,551,615"))
+		_ = uint(maxLength - len("-9,223,372,036,854,775,808"))
+	)
 
 	var (
 		out   = make([]byte, maxLength)
 		i     = maxLength - 1
 		comma = 0
+		sep   = ThousandsSep
 	)
 	for ; n > 0; i-- {
 		if comma == 3 {
 			comma = 0
-			out[i] = ','
+			out[i] = sep
 		} else {
 			comma++
 			out[i] = '0' + byte(n%10)
@@ -227,6 +446,7 @@ func formatLogfmtBigInt(n *big.Int) string {
 		buf   = make([]byte, len(text)+len(text)/3)
 		comma = 0
 		i     = len(buf) - 1
+		sep   = ThousandsSep
 	)
 	for j := len(text) - 1; j >= 0; j, i = j-1, i-1 {
 		c := text[j]
@@ -235,7 +455,7 @@ func formatLogfmtBigInt(n *big.Int) string {
 		case c == '-':
 			buf[i] = c
 		case comma == 3:
-			buf[i] = ','
+			buf[i] = sep
 			i--
 			comma = 0
 			fallthrough
@@ -286,6 +506,34 @@ func formatShared(value interface{}) (result interface{}) {
 		return v.String()
 
 	default:
+		if elem, ok := derefPointers(v); ok {
+			return formatShared(elem)
+		}
 		return v
 	}
 }
+
+// Max pointer indirections followed by derefPointers
+const maxDerefDepth = 8
+
+// derefPointers follows pointer chains like **T down to *T, or a pointer to an interface down to its value.
+// ok is false if value is not such a chain.
+func derefPointers(value interface{}) (elem interface{}, ok bool) {
+	v := reflect.ValueOf(value)
+	for i := 0; i < maxDerefDepth && v.Kind() == reflect.Ptr && !v.IsNil(); i++ {
+		next := v.Elem()
+		if next.Kind() == reflect.Interface {
+			if next.IsNil() {
+				break
+			}
+			next = next.Elem()
+		} else if next.Kind() != reflect.Ptr {
+			break
+		}
+		v, ok = next, true
+	}
+	if !ok {
+		return value, false
+	}
+	return v.Interface(), true
+}
@@ -0,0 +1,249 @@
+package log
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"testing"
+)
+
+// stringifyShared formats a value always going through formatShared, as before the primitive fast path
+func stringifyShared(value interface{}) string {
+	value = formatShared(value)
+	if str, ok := formatPrimitive(value); ok {
+		return str
+	}
+	return escapeString(fmt.Sprintf("%+v", value))
+}
+
+type textValue struct{ text string }
+
+func (v textValue) MarshalText() ([]byte, error) {
+	if v.text == "" {
+		return nil, errors.New("empty")
+	}
+	return []byte(v.text), nil
+}
+
+func TestStringifyTextMarshaler(t *testing.T) {
+	cases := []struct {
+		value  interface{}
+		simple string
+		str    string
+	}{
+		{json.RawMessage(`{"a":1}`), `{"a":1}`, `{"a":1}`},
+		{textValue{"text value"}, "text value", `"text value"`},
+		{textValue{}, "{text:}", "{text:}"},
+	}
+	for _, c := range cases {
+		if v := SimpleFormat(c.value); v != c.simple {
+			t.Fatalf("unexpected SimpleFormat of %#v: %q", c.value, v)
+		}
+		if v := Stringify(c.value); v != c.str {
+			t.Fatalf("unexpected Stringify of %#v: %q", c.value, v)
+		}
+	}
+}
+
+type stringerArg struct{}
+
+func (a *stringerArg) String() string { return "arg" }
+
+func TestStringifyPointerChain(t *testing.T) {
+	arg := &stringerArg{}
+	argp := &arg
+	var stringer fmt.Stringer = Float(1.5)
+	var nilArg *stringerArg
+	var nilStringer fmt.Stringer
+	cases := []struct {
+		value interface{}
+		str   string
+	}{
+		{argp, "arg"},
+		{&argp, "arg"},
+		{&stringer, "1.5"},
+		{&nilArg, "arg"},
+		{&nilStringer, fmt.Sprintf("%+v", &nilStringer)},
+	}
+	for _, c := range cases {
+		if v := SimpleFormat(c.value); v != c.str {
+			t.Fatalf("unexpected SimpleFormat of %T: %q", c.value, v)
+		}
+		if v := Stringify(c.value); v != c.str {
+			t.Fatalf("unexpected Stringify of %T: %q", c.value, v)
+		}
+	}
+}
+
+func TestThousandsSep(t *testing.T) {
+	defer SetThousandsSep(',')
+	if err := SetThousandsSep('.'); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	big, _ := new(big.Int).SetString("-123456789012345678901234", 10)
+	if v := Stringify(1234567); v != "1.234.567" {
+		t.Fatalf("unexpected int format %q", v)
+	}
+	if v := Stringify(uint64(98765432)); v != "98.765.432" {
+		t.Fatalf("unexpected uint format %q", v)
+	}
+	if v := SimpleFormat(big); v != "-123.456.789.012.345.678.901.234" {
+		t.Fatalf("unexpected big int format %q", v)
+	}
+	for _, sep := range []byte{'1', '-', '=', '\t', '\n', 0x80} {
+		if err := SetThousandsSep(sep); err == nil {
+			t.Fatalf("expected error for separator %q", sep)
+		}
+	}
+	if ThousandsSep != '.' {
+		t.Fatalf("invalid separator should be ignored")
+	}
+	if err := SetThousandsSep(' '); err != nil || Stringify(1234567) != "1 234 567" {
+		t.Fatalf("expected space separator, got %q, err %v", Stringify(1234567), err)
+	}
+}
+
+func TestLogfmtIntBounds(t *testing.T) {
+	if v := FormatLogfmtUint64(math.MaxUint64); v != "18,446,744,073,709,551,615" {
+		t.Fatalf("unexpected max uint64 format %q", v)
+	}
+	if v := FormatLogfmtInt64(math.MinInt64); v != "-9,223,372,036,854,775,808" {
+		t.Fatalf("unexpected min int64 format %q", v)
+	}
+	if v := FormatLogfmtInt64(math.MaxInt64); v != "9,223,372,036,854,775,807" {
+		t.Fatalf("unexpected max int64 format %q", v)
+	}
+}
+
+func BenchmarkStringifyInt(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Stringify(123456)
+	}
+}
+
+func BenchmarkStringifyIntShared(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		stringifyShared(123456)
+	}
+}
+
+func BenchmarkStringifyString(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Stringify("value")
+	}
+}
+
+func BenchmarkStringifyStringShared(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		stringifyShared("value")
+	}
+}
+
+func TestStringifyIP(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.1.0.0/16")
+	cases := []struct {
+		value interface{}
+		str   string
+	}{
+		{net.ParseIP("192.168.1.20"), "192.168.1.20"},
+		{net.ParseIP("2001:db8::1"), "2001:db8::1"},
+		{subnet, "10.1.0.0/16"},
+	}
+	for _, c := range cases {
+		if v := SimpleFormat(c.value); v != c.str {
+			t.Fatalf("unexpected SimpleFormat of %#v: %q", c.value, v)
+		}
+		if v := Stringify(c.value); v != c.str {
+			t.Fatalf("unexpected Stringify of %#v: %q", c.value, v)
+		}
+	}
+}
+
+func TestStringifySQLNull(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		str   string
+	}{
+		{sql.NullString{String: "bob", Valid: true}, "bob"},
+		{sql.NullString{String: "bob"}, "null"},
+		{sql.NullInt64{Int64: 42, Valid: true}, "42"},
+		{sql.NullInt64{}, "null"},
+	}
+	for _, c := range cases {
+		if v := SimpleFormat(c.value); v != c.str {
+			t.Fatalf("unexpected SimpleFormat of %#v: %q", c.value, v)
+		}
+		if v := Stringify(c.value); v != c.str {
+			t.Fatalf("unexpected Stringify of %#v: %q", c.value, v)
+		}
+	}
+	if v := string(jsonValue(sql.NullInt64{Int64: 42, Valid: true})); v != "42" {
+		t.Fatalf("unexpected json of valid null int %q", v)
+	}
+	if v := string(jsonValue(sql.NullString{})); v != "null" {
+		t.Fatalf("unexpected json of invalid null string %q", v)
+	}
+}
+
+// Value with a custom %+v format
+type formatterValue struct{ id int }
+
+func (v formatterValue) Format(f fmt.State, verb rune) {
+	if f.Flag('+') {
+		fmt.Fprintf(f, "id:%d", v.id)
+	} else {
+		fmt.Fprintf(f, "%d", v.id)
+	}
+}
+
+// Value implementing both fmt.Stringer and fmt.Formatter
+type stringFormatterValue struct{ formatterValue }
+
+func (v stringFormatterValue) String() string { return "stringer" }
+
+func TestStringifyFormatter(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		str   string
+	}{
+		{formatterValue{7}, "id:7"},
+		{stringFormatterValue{formatterValue{7}}, "stringer"},
+	}
+	for _, c := range cases {
+		if v := SimpleFormat(c.value); v != c.str {
+			t.Fatalf("unexpected SimpleFormat of %#v: %q", c.value, v)
+		}
+		if v := Stringify(c.value); v != c.str {
+			t.Fatalf("unexpected Stringify of %#v: %q", c.value, v)
+		}
+	}
+}
+
+func TestStringifyArray(t *testing.T) {
+	var hash [32]byte
+	for i := range hash {
+		hash[i] = byte(i)
+	}
+	cases := []struct {
+		value  interface{}
+		simple string
+		str    string
+	}{
+		{hash, "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"},
+		{&[2]byte{0xab, 0xcd}, "abcd", "abcd"},
+		{[3]string{"a", "b c", ""}, "[a b c ]", `[a "b c" ]`},
+		{[2]int{1, 100000}, "[1 100000]", "[1 100,000]"},
+	}
+	for _, c := range cases {
+		if v := SimpleFormat(c.value); v != c.simple {
+			t.Fatalf("unexpected SimpleFormat of %#v: %q", c.value, v)
+		}
+		if v := Stringify(c.value); v != c.str {
+			t.Fatalf("unexpected Stringify of %#v: %q", c.value, v)
+		}
+	}
+}
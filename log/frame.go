@@ -0,0 +1,62 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Largest frame accepted by ReadFrame
+const MaxFrameSize = 16 << 20
+
+// FrameWriter writes each log record as a frame prefixed with its 4-byte big-endian length,
+// so readers can find record boundaries without parsing newlines. The trailing newline of a record is dropped.
+type FrameWriter struct {
+	writer io.Writer
+	buf    []byte
+	sync.Mutex
+}
+
+// Create a frame writer writing frames into w
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{writer: w}
+}
+
+// Implement io.Writer interface, every write is a single record
+func (f *FrameWriter) Write(p []byte) (n int, err error) {
+	record := bytes.TrimSuffix(p, []byte{'\n'})
+	if len(record) > MaxFrameSize {
+		return 0, fmt.Errorf("log record of %d bytes exceeds max frame size", len(record))
+	}
+	f.Lock()
+	defer f.Unlock()
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(record)))
+	f.buf = append(append(f.buf[:0], size[:]...), record...)
+	if _, err = writeFull(f.writer, f.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Read a frame written by FrameWriter, io.EOF is returned only if no byte of the frame was read
+func ReadFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > MaxFrameSize {
+		return nil, fmt.Errorf("log frame of %d bytes exceeds max frame size", n)
+	}
+	record := make([]byte, n)
+	if _, err := io.ReadFull(r, record); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return record, nil
+}
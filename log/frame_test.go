@@ -0,0 +1,34 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = NewFrameWriter(&buf)
+	logger.Info("first", "a", 1)
+	logger.Info("multi\nline")
+	logger.Output(INFO, "")
+
+	expected := []string{"] first\ta=1", "] multi\nline", ""}
+	for _, suffix := range expected {
+		frame, err := ReadFrame(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(string(frame), suffix) || bytes.HasSuffix(frame, []byte{'\n'}) {
+			t.Fatalf("unexpected frame %q, expected suffix %q", frame, suffix)
+		}
+	}
+	if _, err := ReadFrame(&buf); err != io.EOF {
+		t.Fatalf("expected EOF after the last frame, got %v", err)
+	}
+	if _, err := ReadFrame(bytes.NewReader([]byte{0, 0, 0, 5, 'a'})); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected unexpected EOF of truncated frame, got %v", err)
+	}
+}
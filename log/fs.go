@@ -0,0 +1,52 @@
+package log
+
+import (
+	"io"
+	"os"
+)
+
+// Handle of an open log file
+type File interface {
+	io.WriteCloser
+	Sync() error
+	Stat() (os.FileInfo, error)
+}
+
+// FS is the file system of log files, replaceable e.g. to test rotation in memory
+type FS interface {
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	// ReadDir lists the directory entries sorted by name
+	ReadDir(name string) ([]os.DirEntry, error)
+	Stat(name string) (os.FileInfo, error)
+}
+
+// File system backed by the os package
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Rename(oldpath, newpath string) error       { return os.Rename(oldpath, newpath) }
+func (osFS) Remove(name string) error                   { return os.Remove(name) }
+func (osFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) Stat(name string) (os.FileInfo, error)      { return os.Stat(name) }
+
+// Get the file system of the log files
+func (w *FileWriter) fs() FS {
+	if w.FS != nil {
+		return w.FS
+	}
+	return osFS{}
+}
+
+// openFile will try to open a log file with desired flags
+func (w *FileWriter) openFile(path string) (File, error) {
+	return w.fs().OpenFile(path, LogFileFlag, 0664)
+}
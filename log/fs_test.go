@@ -0,0 +1,151 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// In memory file system of log files
+type memFS struct {
+	files map[string][]byte
+	sync.Mutex
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: make(map[string][]byte)}
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.files[name]; !ok {
+		if flag&os.O_CREATE == 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		m.files[name] = nil
+	}
+	return &memFile{fs: m, name: name}, nil
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error {
+	m.Lock()
+	defer m.Unlock()
+	data, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = data
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memFS) ReadDir(name string) ([]os.DirEntry, error) {
+	m.Lock()
+	defer m.Unlock()
+	var list []os.DirEntry
+	for path, data := range m.files {
+		if filepath.Dir(path) == name {
+			list = append(list, memInfo{name: filepath.Base(path), size: len(data)})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return memInfo{name: filepath.Base(name), size: len(data)}, nil
+}
+
+// Content of a file, empty if missing
+func (m *memFS) content(name string) string {
+	m.Lock()
+	defer m.Unlock()
+	return string(m.files[name])
+}
+
+// Open file of memFS, appending to the file of its name
+type memFile struct {
+	fs   *memFS
+	name string
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.Lock()
+	defer f.fs.Unlock()
+	f.fs.files[f.name] = append(f.fs.files[f.name], p...)
+	return len(p), nil
+}
+
+func (f *memFile) Close() error               { return nil }
+func (f *memFile) Sync() error                { return nil }
+func (f *memFile) Stat() (os.FileInfo, error) { return f.fs.Stat(f.name) }
+
+// File info and directory entry of a memFS file
+type memInfo struct {
+	name string
+	size int
+}
+
+func (i memInfo) Name() string               { return i.name }
+func (i memInfo) Size() int64                { return int64(i.size) }
+func (i memInfo) Mode() os.FileMode          { return 0664 }
+func (i memInfo) ModTime() time.Time         { return time.Time{} }
+func (i memInfo) IsDir() bool                { return false }
+func (i memInfo) Sys() interface{}           { return nil }
+func (i memInfo) Type() os.FileMode          { return 0 }
+func (i memInfo) Info() (os.FileInfo, error) { return i, nil }
+
+func TestMemFSRotation(t *testing.T) {
+	fs := newMemFS()
+	w, err := NewFileWriter(LogConfig{Path: "/logs/app", FS: fs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.maxSize = 10
+	w.Write([]byte("12345678\n"))
+	w.Write([]byte("abc\n"))
+	list, _ := fs.ReadDir("/logs")
+	if len(list) != 2 || list[0].Name() != "app.log" || !strings.HasPrefix(list[1].Name(), "app.log") {
+		t.Fatalf("expected main log file and one archive, got %v", list)
+	}
+	archive := filepath.Join("/logs", list[1].Name())
+	if fs.content(archive) != "12345678\n" || fs.content("/logs/app.log") != "abc\n" {
+		t.Fatalf("unexpected contents %q %q", fs.content(archive), fs.content("/logs/app.log"))
+	}
+
+	// Older archives beyond MaxFiles are pruned
+	for _, day := range []string{"01", "02", "03"} {
+		fs.files["/logs/app.log2020-01-"+day+"T00:00:00Z"] = []byte("old\n")
+	}
+	w.MaxFiles = 2
+	w.removeStaleLogs("/logs", "app.log")
+	list, _ = fs.ReadDir("/logs")
+	var names []string
+	for _, entry := range list {
+		names = append(names, entry.Name())
+	}
+	if len(names) != 3 || names[0] != "app.log" || names[1] != "app.log2020-01-03T00:00:00Z" || filepath.Join("/logs", names[2]) != archive {
+		t.Fatalf("unexpected files after pruning %q", names)
+	}
+}
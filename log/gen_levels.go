@@ -0,0 +1,69 @@
+//go:build ignore
+
+// Generate the per-level fast path and typed field methods of levels_gen.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+)
+
+var levels = []struct {
+	name, level string
+	debug       bool
+}{
+	{"Trace", "TRACE", true},
+	{"Debug", "DEBUG", true},
+	{"Verbose", "VERBOSE", false},
+	{"Info", "INFO", false},
+	{"Warn", "WARN", false},
+	{"Error", "ERROR", false},
+}
+
+// Field types of the typed methods, e.g. ErrorInt
+var types = []struct{ name, typ, article string }{
+	{"Int", "int", "an"},
+	{"String", "string", "a"},
+	{"Bool", "bool", "a"},
+	{"Float", "float64", "a"},
+}
+
+func main() {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by go run gen_levels.go; DO NOT EDIT.\n\npackage log\n")
+	for _, l := range levels {
+		note, guard := "", ""
+		if l.debug {
+			note = ", compiled out with the nodebug build tag"
+			guard = "\n\tif !debugEnabled {\n\t\treturn\n\t}"
+		}
+		fmt.Fprintf(&b, `
+// Output a %[2]s log message checking the level inline like the %[1]s handle, including Mute and RemapLevel%[4]s
+func (l *Logger) %[1]sFast(msg string, args ...interface{}) {%[3]s
+	if level, ok := l.handled(%[2]s); ok {
+		l.write(level, msg, args...)
+	}
+}
+`, l.name, l.level, guard, note)
+		for _, t := range types {
+			fmt.Fprintf(&b, `
+// Output a %[2]s log message with %[7]s %[5]s field, a fast path of disabled levels which box nothing%[4]s.
+// Enabled lines go through the same rendering as %[1]s calls.
+func (l *Logger) %[1]s%[6]s(msg, key string, v %[5]s) {%[3]s
+	if level, ok := l.handled(%[2]s); ok {
+		l.write(level, msg, key, v)
+	}
+}
+`, l.name, l.level, guard, note, t.typ, t.name, t.article)
+		}
+	}
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		panic(err)
+	}
+	if err = os.WriteFile("levels_gen.go", src, 0644); err != nil {
+		panic(err)
+	}
+}
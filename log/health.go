@@ -0,0 +1,61 @@
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// Number of one second buckets kept by error counters, bounding the ErrorRate window
+const errorBuckets = 300
+
+// Bucketed counter of ERROR emissions per second
+type errorCounter struct {
+	secs   [errorBuckets]int64
+	counts [errorBuckets]int
+	sync.Mutex
+}
+
+func (c *errorCounter) add(level Level, now time.Time) {
+	if level < ERROR {
+		return
+	}
+	sec := now.Unix()
+	i := sec % errorBuckets
+	c.Lock()
+	if c.secs[i] != sec {
+		c.secs[i] = sec
+		c.counts[i] = 0
+	}
+	c.counts[i]++
+	c.Unlock()
+}
+
+// Count emissions of the seconds within window before now
+func (c *errorCounter) count(now time.Time, window time.Duration) (total int) {
+	sec := now.Unix()
+	span := int64(window / time.Second)
+	if span > errorBuckets {
+		span = errorBuckets
+	}
+	c.Lock()
+	for i := range c.secs {
+		if c.secs[i] > sec-span && c.secs[i] <= sec {
+			total += c.counts[i]
+		}
+	}
+	c.Unlock()
+	return
+}
+
+// ErrorRate reports ERROR emissions per second within the recent window, counted in one second buckets.
+// Windows are rounded down to whole seconds and capped at 5 minutes.
+func (l *Logger) ErrorRate(window time.Duration) float64 {
+	if window > errorBuckets*time.Second {
+		window = errorBuckets * time.Second
+	}
+	secs := int64(window / time.Second)
+	if secs <= 0 {
+		return 0
+	}
+	return float64(l.sink().errors.count(l.Clock(), window)) / float64(secs)
+}
@@ -0,0 +1,35 @@
+package log
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestErrorRate(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	logger := NewLogger(nil)
+	logger.writer = io.Discard
+	logger.Clock = func() time.Time { return now }
+	if rate := logger.ErrorRate(time.Minute); rate != 0 {
+		t.Fatalf("unexpected initial error rate %f", rate)
+	}
+	for i := 0; i < 10; i++ {
+		logger.Error("failed")
+		logger.Warn("ignored")
+	}
+	logger.Named("db").Logf(ERROR, "failed %d", 1)
+	logger.Output(ERROR, "failed")
+	now = now.Add(5 * time.Second)
+	logger.Errorf("failed")
+	if rate := logger.ErrorRate(10 * time.Second); rate != 1.3 {
+		t.Fatalf("unexpected error rate %f", rate)
+	}
+	if rate := logger.ErrorRate(time.Second); rate != 1 {
+		t.Fatalf("unexpected error rate of the last second %f", rate)
+	}
+	now = now.Add(time.Hour)
+	if rate := logger.ErrorRate(time.Minute); rate != 0 {
+		t.Fatalf("expected stale errors to expire, got %f", rate)
+	}
+}
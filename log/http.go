@@ -0,0 +1,134 @@
+package log
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ResponseWriter wrapper capturing the response status
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the wrapped ResponseWriter, e.g. for http.ResponseController
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Optional interfaces of the wrapped ResponseWriter forwarded by wrapResponse
+type (
+	responseFlusher    struct{ w *statusWriter }
+	responseHijacker   struct{ w *statusWriter }
+	responseReaderFrom struct{ w *statusWriter }
+)
+
+func (f responseFlusher) Flush() {
+	if f.w.status == 0 {
+		f.w.status = http.StatusOK
+	}
+	f.w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (h responseHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (r responseReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	if r.w.status == 0 {
+		r.w.status = http.StatusOK
+	}
+	return r.w.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+}
+
+// Wrap a status writer implementing http.Flusher, http.Hijacker and io.ReaderFrom only if the wrapped ResponseWriter does,
+// so handlers checking for them, e.g. for streaming or websocket upgrades, behave as without the middleware
+func wrapResponse(w *statusWriter) http.ResponseWriter {
+	_, flusher := w.ResponseWriter.(http.Flusher)
+	_, hijacker := w.ResponseWriter.(http.Hijacker)
+	_, readerFrom := w.ResponseWriter.(io.ReaderFrom)
+	f, h, r := responseFlusher{w}, responseHijacker{w}, responseReaderFrom{w}
+	switch {
+	case flusher && hijacker && readerFrom:
+		return struct {
+			*statusWriter
+			responseFlusher
+			responseHijacker
+			responseReaderFrom
+		}{w, f, h, r}
+	case flusher && hijacker:
+		return struct {
+			*statusWriter
+			responseFlusher
+			responseHijacker
+		}{w, f, h}
+	case flusher && readerFrom:
+		return struct {
+			*statusWriter
+			responseFlusher
+			responseReaderFrom
+		}{w, f, r}
+	case hijacker && readerFrom:
+		return struct {
+			*statusWriter
+			responseHijacker
+			responseReaderFrom
+		}{w, h, r}
+	case flusher:
+		return struct {
+			*statusWriter
+			responseFlusher
+		}{w, f}
+	case hijacker:
+		return struct {
+			*statusWriter
+			responseHijacker
+		}{w, h}
+	case readerFrom:
+		return struct {
+			*statusWriter
+			responseReaderFrom
+		}{w, r}
+	default:
+		return w
+	}
+}
+
+// HTTPMiddleware logs method, path, status and duration of each request, at ERROR for 5xx, WARN for 4xx and INFO otherwise.
+// The trace ID of the request context is attached if any.
+func (l *Logger) HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(wrapResponse(sw), r)
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := INFO
+		switch {
+		case status >= 500:
+			level = ERROR
+		case status >= 400:
+			level = WARN
+		}
+		l.Ctx(r.Context()).Log(level, "HTTP request", "method", r.Method, "path", r.URL.Path, "status", status, "duration", time.Since(start))
+	})
+}
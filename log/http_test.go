@@ -0,0 +1,89 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	handler := logger.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	cases := []struct {
+		path   string
+		level  string
+		status int
+	}{
+		{"/ok", "INFO ", 200},
+		{"/missing", "WARN ", 404},
+		{"/broken", "ERROR", 502},
+	}
+	for _, c := range cases {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		req = req.WithContext(WithTraceID(req.Context(), "t1"))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		pattern := regexp.MustCompile(`^` + c.level + `\[.*\] HTTP request\ttrace_id=t1\tmethod=GET\tpath=` + c.path + `\tstatus=` + strconv.Itoa(c.status) + `\tduration=\S+\n$`)
+		if out := buf.String(); !pattern.MatchString(out) {
+			t.Fatalf("unexpected request log %q", out)
+		}
+	}
+}
+
+// ResponseWriter without any optional interface
+type plainResponseWriter struct {
+	http.ResponseWriter
+}
+
+func TestHTTPMiddlewareInterfaces(t *testing.T) {
+	logger := NewLogger(nil)
+	logger.writer = io.Discard
+	var flusher, hijacker, readerFrom, unwrapped bool
+	handler := logger.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+		_, readerFrom = w.(io.ReaderFrom)
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		unwrapped = ok && u.Unwrap() != nil
+		if flusher {
+			w.(http.Flusher).Flush()
+		}
+	}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !flusher || hijacker || readerFrom || !unwrapped || !recorder.Flushed {
+		t.Fatalf("expected only the flusher of the recorder forwarded, got flusher=%v hijacker=%v readerFrom=%v unwrap=%v",
+			flusher, hijacker, readerFrom, unwrapped)
+	}
+	handler.ServeHTTP(plainResponseWriter{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, "/", nil))
+	if flusher || hijacker || readerFrom || !unwrapped {
+		t.Fatalf("expected no optional interface forwarded")
+	}
+
+	// A server connection supports hijacking and ReadFrom
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !flusher || !hijacker || !readerFrom {
+		t.Fatalf("expected all interfaces of the server forwarded, got flusher=%v hijacker=%v readerFrom=%v", flusher, hijacker, readerFrom)
+	}
+}
@@ -0,0 +1,169 @@
+package log
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Time format of json records
+const JSONTimeFormat = time.RFC3339Nano
+
+// Ordered json object used to render records
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newJSONObject() *jsonObject {
+	return &jsonObject{values: make(map[string]interface{})}
+}
+
+// Set a value keeping the position of an existing key
+func (o *jsonObject) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// Get or create the nested object of the key
+func (o *jsonObject) object(key string) *jsonObject {
+	if child, ok := o.values[key].(*jsonObject); ok {
+		return child
+	}
+	child := newJSONObject()
+	o.set(key, child)
+	return child
+}
+
+func (o *jsonObject) encode(b *bytes.Buffer) {
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(jsonValue(key))
+		b.WriteByte(':')
+		if child, ok := o.values[key].(*jsonObject); ok {
+			child.encode(b)
+		} else {
+			b.Write(jsonValue(o.values[key]))
+		}
+	}
+	b.WriteByte('}')
+}
+
+// Marshal a field value, values without a json representation are rendered as strings
+func jsonValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case json.Marshaler, encoding.TextMarshaler:
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	case driver.Valuer:
+		if val, ok := driverValue(v); ok {
+			value = val
+		}
+	}
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		bytes, _ = json.Marshal(FormatValue(value))
+	}
+	return bytes
+}
+
+// Key of a record field renamed by keys, the name itself if not renamed
+func jsonKey(keys map[string]string, name string) string {
+	if key, ok := keys[name]; ok && key != "" {
+		return key
+	}
+	return name
+}
+
+// Render a log record as a json line, keys renames the time, level and msg fields.
+// Field and group names colliding with those fields are namespaced as "fields.<name>", prefixed again while that's taken too
+func formatJSON(keys map[string]string, level string, now time.Time, msg string, args ...interface{}) string {
+	record := newJSONObject()
+	timeKey, levelKey, msgKey := jsonKey(keys, "time"), jsonKey(keys, "level"), jsonKey(keys, "msg")
+	record.set(timeKey, now.Format(JSONTimeFormat))
+	record.set(levelKey, level)
+	record.set(msgKey, msg)
+	count := len(args)
+	names := make(map[string]bool, count/2)
+	for i := 0; i < count; i += 2 {
+		if key, ok := args[i].(groupKey); ok && len(key.path) > 0 {
+			names[key.path[0]] = true
+		} else if ok {
+			names[key.key] = true
+		} else {
+			names[FormatValue(args[i])] = true
+		}
+	}
+	field := func(name string) string {
+		if name != timeKey && name != levelKey && name != msgKey {
+			return name
+		}
+		for taken := true; taken; {
+			name = "fields." + name
+			taken = names[name] || name == timeKey || name == levelKey || name == msgKey
+		}
+		return name
+	}
+	for i := 0; i < count; i += 2 {
+		var value interface{}
+		if i+1 < count {
+			value = args[i+1]
+		}
+		if key, ok := args[i].(groupKey); ok && len(key.path) > 0 {
+			obj := record.object(field(key.path[0]))
+			for _, name := range key.path[1:] {
+				obj = obj.object(name)
+			}
+			obj.set(key.key, value)
+		} else if ok {
+			record.set(field(key.key), value)
+		} else {
+			record.set(field(FormatValue(args[i])), value)
+		}
+	}
+	var b bytes.Buffer
+	record.encode(&b)
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// Render a caller supplied record as a json line with time and level merged in,
+// record keys colliding with those fields are namespaced as "fields.<key>", prefixed again while that's taken too
+func formatRecord(keys map[string]string, level string, now time.Time, fields map[string]interface{}) []byte {
+	record := newJSONObject()
+	timeKey, levelKey := jsonKey(keys, "time"), jsonKey(keys, "level")
+	record.set(timeKey, now.Format(JSONTimeFormat))
+	record.set(levelKey, level)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key := name
+		if key == timeKey || key == levelKey {
+			for taken := true; taken; {
+				key = "fields." + key
+				_, taken = fields[key]
+				if _, ok := record.values[key]; ok {
+					taken = true
+				}
+			}
+		}
+		record.set(key, fields[name])
+	}
+	var b bytes.Buffer
+	record.encode(&b)
+	return b.Bytes()
+}
@@ -0,0 +1,267 @@
+// Code generated by go run gen_levels.go; DO NOT EDIT.
+
+package log
+
+// Output a TRACE log message checking the level inline like the Trace handle, including Mute and RemapLevel, compiled out with the nodebug build tag
+func (l *Logger) TraceFast(msg string, args ...interface{}) {
+	if !debugEnabled {
+		return
+	}
+	if level, ok := l.handled(TRACE); ok {
+		l.write(level, msg, args...)
+	}
+}
+
+// Output a TRACE log message with an int field, a fast path of disabled levels which box nothing, compiled out with the nodebug build tag.
+// Enabled lines go through the same rendering as Trace calls.
+func (l *Logger) TraceInt(msg, key string, v int) {
+	if !debugEnabled {
+		return
+	}
+	if level, ok := l.handled(TRACE); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a TRACE log message with a string field, a fast path of disabled levels which box nothing, compiled out with the nodebug build tag.
+// Enabled lines go through the same rendering as Trace calls.
+func (l *Logger) TraceString(msg, key string, v string) {
+	if !debugEnabled {
+		return
+	}
+	if level, ok := l.handled(TRACE); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a TRACE log message with a bool field, a fast path of disabled levels which box nothing, compiled out with the nodebug build tag.
+// Enabled lines go through the same rendering as Trace calls.
+func (l *Logger) TraceBool(msg, key string, v bool) {
+	if !debugEnabled {
+		return
+	}
+	if level, ok := l.handled(TRACE); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a TRACE log message with a float64 field, a fast path of disabled levels which box nothing, compiled out with the nodebug build tag.
+// Enabled lines go through the same rendering as Trace calls.
+func (l *Logger) TraceFloat(msg, key string, v float64) {
+	if !debugEnabled {
+		return
+	}
+	if level, ok := l.handled(TRACE); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a DEBUG log message checking the level inline like the Debug handle, including Mute and RemapLevel, compiled out with the nodebug build tag
+func (l *Logger) DebugFast(msg string, args ...interface{}) {
+	if !debugEnabled {
+		return
+	}
+	if level, ok := l.handled(DEBUG); ok {
+		l.write(level, msg, args...)
+	}
+}
+
+// Output a DEBUG log message with an int field, a fast path of disabled levels which box nothing, compiled out with the nodebug build tag.
+// Enabled lines go through the same rendering as Debug calls.
+func (l *Logger) DebugInt(msg, key string, v int) {
+	if !debugEnabled {
+		return
+	}
+	if level, ok := l.handled(DEBUG); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a DEBUG log message with a string field, a fast path of disabled levels which box nothing, compiled out with the nodebug build tag.
+// Enabled lines go through the same rendering as Debug calls.
+func (l *Logger) DebugString(msg, key string, v string) {
+	if !debugEnabled {
+		return
+	}
+	if level, ok := l.handled(DEBUG); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a DEBUG log message with a bool field, a fast path of disabled levels which box nothing, compiled out with the nodebug build tag.
+// Enabled lines go through the same rendering as Debug calls.
+func (l *Logger) DebugBool(msg, key string, v bool) {
+	if !debugEnabled {
+		return
+	}
+	if level, ok := l.handled(DEBUG); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a DEBUG log message with a float64 field, a fast path of disabled levels which box nothing, compiled out with the nodebug build tag.
+// Enabled lines go through the same rendering as Debug calls.
+func (l *Logger) DebugFloat(msg, key string, v float64) {
+	if !debugEnabled {
+		return
+	}
+	if level, ok := l.handled(DEBUG); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a VERBOSE log message checking the level inline like the Verbose handle, including Mute and RemapLevel
+func (l *Logger) VerboseFast(msg string, args ...interface{}) {
+	if level, ok := l.handled(VERBOSE); ok {
+		l.write(level, msg, args...)
+	}
+}
+
+// Output a VERBOSE log message with an int field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Verbose calls.
+func (l *Logger) VerboseInt(msg, key string, v int) {
+	if level, ok := l.handled(VERBOSE); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a VERBOSE log message with a string field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Verbose calls.
+func (l *Logger) VerboseString(msg, key string, v string) {
+	if level, ok := l.handled(VERBOSE); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a VERBOSE log message with a bool field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Verbose calls.
+func (l *Logger) VerboseBool(msg, key string, v bool) {
+	if level, ok := l.handled(VERBOSE); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a VERBOSE log message with a float64 field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Verbose calls.
+func (l *Logger) VerboseFloat(msg, key string, v float64) {
+	if level, ok := l.handled(VERBOSE); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a INFO log message checking the level inline like the Info handle, including Mute and RemapLevel
+func (l *Logger) InfoFast(msg string, args ...interface{}) {
+	if level, ok := l.handled(INFO); ok {
+		l.write(level, msg, args...)
+	}
+}
+
+// Output a INFO log message with an int field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Info calls.
+func (l *Logger) InfoInt(msg, key string, v int) {
+	if level, ok := l.handled(INFO); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a INFO log message with a string field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Info calls.
+func (l *Logger) InfoString(msg, key string, v string) {
+	if level, ok := l.handled(INFO); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a INFO log message with a bool field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Info calls.
+func (l *Logger) InfoBool(msg, key string, v bool) {
+	if level, ok := l.handled(INFO); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a INFO log message with a float64 field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Info calls.
+func (l *Logger) InfoFloat(msg, key string, v float64) {
+	if level, ok := l.handled(INFO); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a WARN log message checking the level inline like the Warn handle, including Mute and RemapLevel
+func (l *Logger) WarnFast(msg string, args ...interface{}) {
+	if level, ok := l.handled(WARN); ok {
+		l.write(level, msg, args...)
+	}
+}
+
+// Output a WARN log message with an int field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Warn calls.
+func (l *Logger) WarnInt(msg, key string, v int) {
+	if level, ok := l.handled(WARN); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a WARN log message with a string field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Warn calls.
+func (l *Logger) WarnString(msg, key string, v string) {
+	if level, ok := l.handled(WARN); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a WARN log message with a bool field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Warn calls.
+func (l *Logger) WarnBool(msg, key string, v bool) {
+	if level, ok := l.handled(WARN); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a WARN log message with a float64 field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Warn calls.
+func (l *Logger) WarnFloat(msg, key string, v float64) {
+	if level, ok := l.handled(WARN); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a ERROR log message checking the level inline like the Error handle, including Mute and RemapLevel
+func (l *Logger) ErrorFast(msg string, args ...interface{}) {
+	if level, ok := l.handled(ERROR); ok {
+		l.write(level, msg, args...)
+	}
+}
+
+// Output a ERROR log message with an int field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Error calls.
+func (l *Logger) ErrorInt(msg, key string, v int) {
+	if level, ok := l.handled(ERROR); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a ERROR log message with a string field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Error calls.
+func (l *Logger) ErrorString(msg, key string, v string) {
+	if level, ok := l.handled(ERROR); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a ERROR log message with a bool field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Error calls.
+func (l *Logger) ErrorBool(msg, key string, v bool) {
+	if level, ok := l.handled(ERROR); ok {
+		l.write(level, msg, key, v)
+	}
+}
+
+// Output a ERROR log message with a float64 field, a fast path of disabled levels which box nothing.
+// Enabled lines go through the same rendering as Error calls.
+func (l *Logger) ErrorFloat(msg, key string, v float64) {
+	if level, ok := l.handled(ERROR); ok {
+		l.write(level, msg, key, v)
+	}
+}
@@ -0,0 +1,144 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Run with and without the nodebug build tag: go test -tags nodebug
+func TestFastHandles(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.SetLevel(TRACE)
+	logger.TraceFast("trace", "a", 1)
+	logger.DebugFast("debug")
+	logger.InfoFast("info")
+	logger.SetLevel(WARN)
+	logger.InfoFast("hidden")
+	logger.ErrorFast("error")
+
+	expected := []string{"] info", "] error"}
+	if debugEnabled {
+		expected = append([]string{"] trace\ta=1", "] debug"}, expected...)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, expected[i]) {
+			t.Fatalf("unexpected line %q, expected suffix %q", line, expected[i])
+		}
+	}
+}
+
+func TestFastHandlesMuteAndRemap(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{RemapLevel: func(level Level) Level {
+		if level == ERROR {
+			return DEBUG
+		}
+		return level
+	}})
+	logger.writer = &buf
+	logger.Mute(INFO)
+	logger.InfoFast("muted")
+	logger.ErrorFast("remapped")
+	logger.WarnFast("warn")
+	if out := buf.String(); strings.Contains(out, "muted") || strings.Contains(out, "remapped") || !strings.HasPrefix(out, "WARN [") {
+		t.Fatalf("unexpected output %q", out)
+	}
+	buf.Reset()
+	logger.SetLevel(DEBUG)
+	logger.ErrorFast("remapped")
+	if out := buf.String(); !strings.HasPrefix(out, "DEBUG[") || !strings.HasSuffix(out, "] remapped\n") {
+		t.Fatalf("expected the line logged at the remapped level, got %q", out)
+	}
+}
+
+func TestTypedHandles(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.InfoInt("count", "n", 3)
+	logger.WarnString("user", "name", "alice")
+	logger.ErrorBool("ready", "ok", false)
+	logger.InfoFloat("ratio", "r", 0.5)
+	logger.DebugInt("hidden", "n", 1)
+	expected := []string{"] count\tn=3", "] user\tname=alice", "] ready\tok=false", "] ratio\tr=0.500"}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, expected[i]) {
+			t.Fatalf("unexpected line %q, expected suffix %q", line, expected[i])
+		}
+	}
+}
+
+func TestTypedHandlesMuteAndRemap(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{RemapLevel: func(level Level) Level {
+		if level == ERROR {
+			return DEBUG
+		}
+		return level
+	}})
+	logger.writer = &buf
+	logger.Mute(WARN)
+	logger.WarnString("muted", "k", "v")
+	logger.ErrorInt("remapped", "n", 1)
+	logger.InfoBool("info", "ok", true)
+	if out := buf.String(); strings.Contains(out, "muted") || strings.Contains(out, "remapped") || !strings.HasSuffix(out, "] info\tok=true\n") {
+		t.Fatalf("unexpected output %q", out)
+	}
+	buf.Reset()
+	logger.SetLevel(DEBUG)
+	logger.ErrorInt("remapped", "n", 1)
+	if out := buf.String(); !strings.HasPrefix(out, "DEBUG[") || !strings.HasSuffix(out, "] remapped\tn=1\n") {
+		t.Fatalf("expected the line logged at the remapped level, got %q", out)
+	}
+}
+
+// Typed methods only save the boxing of disabled levels, enabled lines render alike, see BenchmarkTyped
+func BenchmarkTypedDisabled(b *testing.B) {
+	logger := NewLogger(nil)
+	logger.writer = io.Discard
+	logger.SetLevel(ERROR)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.InfoInt("Hot path", "i", i+1000)
+	}
+}
+
+func BenchmarkVariadicDisabled(b *testing.B) {
+	logger := NewLogger(nil)
+	logger.writer = io.Discard
+	logger.SetLevel(ERROR)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Info("Hot path", "i", i+1000)
+	}
+}
+
+func BenchmarkTyped(b *testing.B) {
+	logger := NewLogger(nil)
+	logger.writer = io.Discard
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.InfoInt("Hot path", "i", i+1000)
+	}
+}
+
+func BenchmarkVariadic(b *testing.B) {
+	logger := NewLogger(nil)
+	logger.writer = io.Discard
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Info("Hot path", "i", i+1000)
+	}
+}
@@ -0,0 +1,136 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Bounds of the partial lines kept by a LineWriter. A partial line older than PartialLineTimeout, e.g. of a goroutine
+// which exited without finishing it, is forwarded terminated by a newline, and so is the oldest one beyond MaxPartialLines.
+var (
+	MaxPartialLines    = 1024
+	PartialLineTimeout = time.Minute
+)
+
+// LineWriter buffers partial writes per goroutine and forwards only complete lines to the underlying writer,
+// so chunked writes from concurrent goroutines never interleave within a line.
+type LineWriter struct {
+	writer  io.Writer
+	partial map[uint64]*partialLine
+	// Last time expired partial lines were forwarded
+	swept time.Time
+	sync.Mutex
+}
+
+// Partial line of a goroutine and the time it started
+type partialLine struct {
+	buf   []byte
+	since time.Time
+}
+
+// Create a line writer on top of the writer
+func NewLineWriter(w io.Writer) *LineWriter {
+	return &LineWriter{writer: w, partial: make(map[uint64]*partialLine)}
+}
+
+// Implement io.Writer interface, complete lines are forwarded in a single write.
+// The goroutine is only looked up if the write is not made of complete lines or partial lines are pending.
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	if len(w.partial) == 0 && len(p) > 0 && p[len(p)-1] == '\n' {
+		if _, err := w.writer.Write(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	now := time.Now()
+	w.expire(now)
+	id := goroutineID()
+	line := w.partial[id]
+	if line == nil {
+		line = &partialLine{since: now}
+	}
+	buf := append(line.buf, p...)
+	end := bytes.LastIndexByte(buf, '\n') + 1
+	if end == 0 {
+		line.buf = buf
+		w.partial[id] = line
+		w.limit()
+		return len(p), nil
+	}
+	if end < len(buf) {
+		w.partial[id] = &partialLine{buf: append([]byte(nil), buf[end:]...), since: now}
+		w.limit()
+	} else {
+		delete(w.partial, id)
+	}
+	if _, err := w.writer.Write(buf[:end]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Forward the partial lines older than PartialLineTimeout, checked at most once per PartialLineTimeout
+func (w *LineWriter) expire(now time.Time) {
+	if len(w.partial) == 0 || now.Sub(w.swept) < PartialLineTimeout {
+		return
+	}
+	w.swept = now
+	for id, line := range w.partial {
+		if now.Sub(line.since) >= PartialLineTimeout {
+			w.forward(line.buf)
+			delete(w.partial, id)
+		}
+	}
+}
+
+// Forward the oldest partial lines beyond MaxPartialLines
+func (w *LineWriter) limit() {
+	for MaxPartialLines > 0 && len(w.partial) > MaxPartialLines {
+		var oldest uint64
+		var since time.Time
+		for id, line := range w.partial {
+			if since.IsZero() || line.since.Before(since) {
+				oldest, since = id, line.since
+			}
+		}
+		w.forward(w.partial[oldest].buf)
+		delete(w.partial, oldest)
+	}
+}
+
+// Forward a partial line terminated by a newline, so the next line is not glued onto it
+func (w *LineWriter) forward(buf []byte) error {
+	_, err := w.writer.Write(append(buf, '\n'))
+	return err
+}
+
+// Flush forwards the pending partial lines of all goroutines, each terminated by a newline
+func (w *LineWriter) Flush() (err error) {
+	w.Lock()
+	defer w.Unlock()
+	for id, line := range w.partial {
+		if e := w.forward(line.buf); e != nil && err == nil {
+			err = e
+		}
+		delete(w.partial, id)
+	}
+	return
+}
+
+// Parse the current goroutine id from the stack header "goroutine N [...]"
+func goroutineID() uint64 {
+	var buf [64]byte
+	header := buf[:runtime.Stack(buf[:], false)]
+	header = bytes.TrimPrefix(header, []byte("goroutine "))
+	if i := bytes.IndexByte(header, ' '); i > 0 {
+		header = header[:i]
+	}
+	id, _ := strconv.ParseUint(string(header), 10, 64)
+	return id
+}
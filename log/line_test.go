@@ -0,0 +1,84 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLineWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLineWriter(&buf)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				line := fmt.Sprintf("goroutine %d line %d\n", g, i)
+				for len(line) > 0 {
+					n := 3
+					if n > len(line) {
+						n = len(line)
+					}
+					w.Write([]byte(line[:n]))
+					line = line[n:]
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 800 {
+		t.Fatalf("expected 800 lines, got %d", len(lines))
+	}
+	next := make(map[int]int)
+	for _, line := range lines {
+		var g, i int
+		if _, err := fmt.Sscanf(line, "goroutine %d line %d", &g, &i); err != nil || next[g] != i {
+			t.Fatalf("interleaved line %q", line)
+		}
+		next[g]++
+	}
+
+	buf.Reset()
+	w.Write([]byte("partial"))
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected forwarded partial line %q", buf.String())
+	}
+	w.Flush()
+	if buf.String() != "partial\n" {
+		t.Fatalf("expected partial line on flush, got %q", buf.String())
+	}
+}
+
+func TestLineWriterBounds(t *testing.T) {
+	defer func(max int, timeout time.Duration) { MaxPartialLines, PartialLineTimeout = max, timeout }(MaxPartialLines, PartialLineTimeout)
+	MaxPartialLines, PartialLineTimeout = 2, time.Hour
+	var buf bytes.Buffer
+	w := NewLineWriter(&buf)
+	var wg sync.WaitGroup
+	for _, part := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		// Each partial line is left behind by an exited goroutine
+		go func(part string) {
+			defer wg.Done()
+			w.Write([]byte(part))
+		}(part)
+		wg.Wait()
+	}
+	if len(w.partial) != 2 || buf.String() != "a\n" {
+		t.Fatalf("expected the oldest partial line forwarded, got %q with %d pending", buf.String(), len(w.partial))
+	}
+
+	PartialLineTimeout = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+	w.Write([]byte("d"))
+	if lines := strings.Split(buf.String(), "\n"); len(w.partial) != 1 || len(lines) != 4 || lines[0] != "a" ||
+		len(lines[1]) != 1 || len(lines[2]) != 1 || lines[3] != "" {
+		t.Fatalf("expected expired partial lines forwarded, got %q with %d pending", buf.String(), len(w.partial))
+	}
+}
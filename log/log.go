@@ -1,13 +1,22 @@
+//go:generate go run gen_levels.go
+
 package log
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"os"
+	"runtime"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,8 +31,10 @@ const (
 )
 
 var (
-	// Log levels as string
-	Levels = [6]string{"TRACE", "DEBUG", "VERBOSE", "INFO", "WARN", "ERROR"}
+	// Log levels as string, indexed by level, extended by RegisterLevel
+	Levels = []string{"TRACE", "DEBUG", "VERBOSE", "INFO", "WARN", "ERROR"}
+	// Alternative level names accepted by ParseLevel, e.g. abbreviations, upper case
+	LevelAliases = map[string]Level{"VERBO": VERBOSE}
 
 	FormatValue func(interface{}) string = SimpleFormat
 )
@@ -33,15 +44,55 @@ func stringifyLevel(level Level) string {
 	return Levels[level]
 }
 
+// Max length of custom level names
+const maxLevelWidth = 8
+
+// RegisterLevel adds a custom level above all existing levels, usable with Log, Handle and the other leveled methods.
+// Levels are not guarded against concurrent access, so register them during initialization.
+func RegisterLevel(name string, value Level) error {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" || len(name) > maxLevelWidth {
+		return fmt.Errorf("invalid log level name %q, expecting 1 to %d characters", name, maxLevelWidth)
+	}
+	if _, err := ParseLevelStrict(name); err == nil {
+		return fmt.Errorf("log level %s already exists", name)
+	}
+	if int(value) < len(Levels) {
+		return fmt.Errorf("log level %s value %d must be above %s", name, int(value), Levels[len(Levels)-1])
+	}
+	for Level(len(Levels)) < value {
+		Levels = append(Levels, "")
+	}
+	Levels = append(Levels, name)
+	return nil
+}
+
+// Check if the level is a known level
+func validLevel(level Level) bool {
+	return level >= 0 && int(level) < len(Levels) && Levels[level] != ""
+}
+
 // Parse level string
 func ParseLevel(target string) Level {
-	target = strings.ToUpper(target)
+	level, err := ParseLevelStrict(target)
+	if err != nil {
+		return INFO
+	}
+	return level
+}
+
+// Parse level string, returns an error for unknown levels
+func ParseLevelStrict(target string) (Level, error) {
+	name := strings.ToUpper(target)
 	for level, str := range Levels {
-		if str == target {
-			return Level(level)
+		if str != "" && str == name {
+			return Level(level), nil
 		}
 	}
-	return INFO
+	if level, ok := LevelAliases[name]; ok && validLevel(level) {
+		return level, nil
+	}
+	return INFO, fmt.Errorf("invalid log level %q", target)
 }
 
 var (
@@ -61,15 +112,41 @@ var (
 	Json, Dump func(Level, interface{})
 	JsonIf, DumpIf(func(bool, Level, interface{}))
 
+	// Output an INFO message formatted exactly like fmt.Printf, for migrating from the standard library
+	Printf func(string, ...interface{})
+
+	// Global printf style handles for different levels
+	Tracef, Debugf, Verbosef, Infof, Warnf, Errorf func(string, ...interface{})
+
+	// Global println style handles for different levels
+	Traceln, Debugln, Verboseln, Infoln, Warnln, Errorln func(...interface{})
+
 	// Global handles for different levels
 	Trace, Debug, Verbose, Info, Warn, Error Handle
 
 	// Global handleIfs for different levels
 	TraceIf, DebugIf, VerboseIf, InfoIf, WarnIf, ErrorIf HandleIf
 
-	// default zero handle to discard messages
-	discard = func(string, ...interface{}) {}
-	discardIf = func(bool, string, ...interface{}) {}
+	// Max stack frames kept by GetStackInfo after omitting logger internals, 0 means no limit
+	MaxStackFrames int
+
+	// Max stack captures per second by Fatal, Assert, StackInfo and Recover, message only beyond it. 0 means no limit
+	MaxStacksPerSecond int
+
+	// Format of stack info attached by Fatal and Assert
+	StackInfoFormat = StackFull
+
+	// Max bytes dumped by HexDump, 0 means no limit
+	MaxHexDump = 4096
+
+	// Consecutive write failures after which a logger reopens its log file or discards output, 0 to never give up
+	MaxWriteFailures = 10
+
+	// Error of a write abandoned after LogConfig.WriteTimeout
+	ErrWriteTimeout = errors.New("log write timed out")
+
+	// Process exit hook used by Fatal and Assert, replaceable in tests
+	exit = os.Exit
 )
 
 func init() {
@@ -77,13 +154,39 @@ func init() {
 }
 
 // Initialize global logger
-// Read default log level from config or global env variable LOG_LEVEL
+// Read default log level from config or global env variable LOG_LEVEL when config is nil
+// An unknown LOG_LEVEL is warned about when env variable LOG_LEVEL_STRICT=1 is set
 func Init(config *LogConfig) {
-	Root = NewLogger(config)
-	level := ParseLevel(os.Getenv("LOG_LEVEL"))
+	level, err := rootLevel(config)
+	initRoot(config, level)
+	if err != nil && os.Getenv("LOG_LEVEL_STRICT") == "1" {
+		Root.Warn("Invalid LOG_LEVEL env, will use INFO by default", "err", err)
+	}
+}
+
+// Initialize global logger like Init, returns an error without replacing Root if LOG_LEVEL is used and set to an unknown level
+func InitStrict(config *LogConfig) error {
+	level, err := rootLevel(config)
+	if err != nil {
+		return err
+	}
+	initRoot(config, level)
+	return nil
+}
+
+// Get the root logger level from config, or from env variable LOG_LEVEL when config is nil
+func rootLevel(config *LogConfig) (Level, error) {
 	if config != nil {
-		level = config.Level
+		return config.Level, nil
+	}
+	if env := os.Getenv("LOG_LEVEL"); env != "" {
+		return ParseLevelStrict(env)
 	}
+	return INFO, nil
+}
+
+func initRoot(config *LogConfig, level Level) {
+	Root = NewLogger(config)
 	Root.SetLevel(level)
 	applyGlobalHanldes()
 }
@@ -94,12 +197,35 @@ func SetLevel(target Level) {
 	applyGlobalHanldes()
 }
 
+// Set logger level by name for root logger, see Logger.SetLevelString
+func SetLevelString(name string) error {
+	level, err := ParseLevelStrict(name)
+	if err != nil {
+		return err
+	}
+	SetLevel(level)
+	return nil
+}
+
+// Mute a single level for root logger
+func Mute(level Level) {
+	Root.Mute(level)
+	applyGlobalHanldes()
+}
+
+// Unmute a single level for root logger
+func Unmute(level Level) {
+	Root.Unmute(level)
+	applyGlobalHanldes()
+}
+
 func applyGlobalHanldes() {
 	Output = Root.Output
 	Outputf = Root.Outputf
 	Log = Root.Log
 	Logf = Root.Logf
 	Println = Root.Println
+	Printf = Root.Printf
 	Trace = Root.Trace
 	Debug = Root.Debug
 	Verbose = Root.Verbose
@@ -109,6 +235,20 @@ func applyGlobalHanldes() {
 	Json = Root.Json
 	Dump = Root.Dump
 
+	Tracef = Root.Tracef
+	Debugf = Root.Debugf
+	Verbosef = Root.Verbosef
+	Infof = Root.Infof
+	Warnf = Root.Warnf
+	Errorf = Root.Errorf
+
+	Traceln = Root.Traceln
+	Debugln = Root.Debugln
+	Verboseln = Root.Verboseln
+	Infoln = Root.Infoln
+	Warnln = Root.Warnln
+	Errorln = Root.Errorln
+
 	TraceIf = Root.TraceIf
 	DebugIf = Root.DebugIf
 	VerboseIf = Root.VerboseIf
@@ -131,8 +271,22 @@ func Format(msg string, args ...interface{}) string {
 	return msg
 }
 
-// Dump stack info with hiding logger internal calls
+// Format of stack info
+type StackFormat int
+
+const (
+	// Raw output of debug.Stack, two lines per frame
+	StackFull StackFormat = iota
+	// One func (file:line) line per frame
+	StackCompact
+)
+
+// Dump stack info with hiding logger internal calls, omitCalls counts the lines of the full format
 func GetStackInfo(omitCalls int) string {
+	if StackInfoFormat == StackCompact {
+		// Skip the goroutine header, the rest are two lines per frame with compactStack in place of debug.Stack
+		return compactStack((omitCalls-1)/2 + 1)
+	}
 	info := string(debug.Stack())
 	start := 0
 	count := 0
@@ -146,21 +300,170 @@ func GetStackInfo(omitCalls int) string {
 		}
 	}
 	if start < len(info) {
-		return info[start:]
-	} else {
-		return info
+		info = info[start:]
+	}
+	if MaxStackFrames > 0 {
+		// Each frame takes two lines: the function call and its source location
+		count = 0
+		for i, token := range info {
+			if token == 0x0A {
+				count++
+				if count == MaxStackFrames*2 {
+					if i+1 < len(info) {
+						info = info[:i+1] + "...\n"
+					}
+					break
+				}
+			}
+		}
+	}
+	return info
+}
+
+// Render the stack in the compact format, skipping frames of compactStack and its callers as runtime.Callers does
+func compactStack(skip int) string {
+	var b strings.Builder
+	frames, truncated := callerFrames(skip + 1)
+	for _, frame := range frames {
+		fmt.Fprintf(&b, "%s (%s:%d)\n", frame.Function, frame.File, frame.Line)
+	}
+	if truncated {
+		b.WriteString("...\n")
+	}
+	return b.String()
+}
+
+// Frame of a stack in json records
+type stackFrame struct {
+	Func string `json:"func"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// Get the stack as json frames, skipping frames of stackFrames and its callers as runtime.Callers does
+func stackFrames(skip int) []stackFrame {
+	frames, _ := callerFrames(skip + 1)
+	out := make([]stackFrame, len(frames))
+	for i, frame := range frames {
+		out[i] = stackFrame{Func: frame.Function, File: frame.File, Line: frame.Line}
+	}
+	return out
+}
+
+// Get up to MaxStackFrames frames of the stack, skipping frames of callerFrames and its callers as runtime.Callers does
+func callerFrames(skip int) (out []runtime.Frame, truncated bool) {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip, pcs)
+	for n == len(pcs) {
+		pcs = make([]uintptr, len(pcs)*2)
+		n = runtime.Callers(skip, pcs)
+	}
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if MaxStackFrames > 0 && len(out) == MaxStackFrames {
+			return out, true
+		}
+		out = append(out, frame)
+		if !more {
+			return
+		}
 	}
 }
 
 // Fatal will exit the process after the log message is printed with stack info attached
 func Fatal(msg string, args ...interface{}) {
-	Output(ERROR, StackInfo(9, msg, args...))
-	os.Exit(2)
+	line := Root.stackLine("FATAL", 9, msg, args...)
+	fatalOnce(func() {
+		Output(ERROR, line)
+		Root.dumpCrash()
+		exit(2)
+	})
+}
+
+var (
+	fatalLock  sync.Mutex
+	fatalGuard = new(sync.Once)
+)
+
+// Run the fatal exit of the first of concurrent fatal calls, the others block until it returns and skip theirs,
+// so stacks don't interleave before the exit. It returns only with exit replaced in tests, renewing the guard then.
+func fatalOnce(fn func()) {
+	fatalLock.Lock()
+	guard := fatalGuard
+	fatalLock.Unlock()
+	guard.Do(func() {
+		fn()
+		fatalLock.Lock()
+		fatalGuard = new(sync.Once)
+		fatalLock.Unlock()
+	})
 }
 
 // Append stack info to given message with args
 func StackInfo(omitCalls int, msg string, args ...interface{}) string {
-	return fmt.Sprintf("FATAL[%s] %s\n%s", time.Now().Format(TimeFormat), Format(msg, args...), GetStackInfo(omitCalls))
+	return stackInfo(time.Now().Format(TimeFormat), "FATAL", omitCalls+2, msg, args...)
+}
+
+func stackInfo(stamp, label string, omitCalls int, msg string, args ...interface{}) string {
+	if !stackLimiter.allow(time.Now()) {
+		return fmt.Sprintf("%s[%s] %s\n(stack omitted, rate limited)\n", label, stamp, Format(msg, args...))
+	}
+	return fmt.Sprintf("%s[%s] %s\n%s", label, stamp, Format(msg, args...), GetStackInfo(omitCalls))
+}
+
+// Render a message with stack info attached like stackInfo, as a json record with a stack array of frames in JSONFormat
+func (l *Logger) stackLine(label string, omitCalls int, msg string, args ...interface{}) string {
+	opts := l.opts()
+	if opts.format != JSONFormat {
+		return stackInfo(opts.timestamp(l.Clock()), opts.levelLabel(label), omitCalls+2, msg, args...)
+	}
+	if len(args)&1 == 1 {
+		args = append(args, "")
+	}
+	if stackLimiter.allow(time.Now()) {
+		// Skip the goroutine header, the rest are two lines per frame of debug.Stack, without GetStackInfo and stackInfo
+		args = append(args[:len(args):len(args)], "stack", stackFrames((omitCalls-1)/2))
+	} else {
+		args = append(args[:len(args):len(args)], "stack", "omitted, rate limited")
+	}
+	var keys map[string]string
+	if opts.config != nil {
+		keys = opts.config.JSONKeys
+	}
+	return strings.TrimSuffix(formatJSON(keys, label, l.Clock(), msg, args...), "\n")
+}
+
+// Token bucket limiting stack captures to MaxStacksPerSecond with bursts of the same size
+type stackBucket struct {
+	tokens float64
+	last   time.Time
+	sync.Mutex
+}
+
+var stackLimiter stackBucket
+
+func (b *stackBucket) allow(now time.Time) bool {
+	rate := float64(MaxStacksPerSecond)
+	if rate <= 0 {
+		return true
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.last.IsZero() {
+		b.tokens = rate
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * rate
+	}
+	if b.tokens > rate {
+		b.tokens = rate
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
 }
 
 // Assert a condition, fatal otherwise
@@ -168,10 +471,22 @@ func Assert(check bool, msg string, args ...interface{}) {
 	if check {
 		return
 	}
-	Output(ERROR, StackInfo(9, msg, args...))
-	os.Exit(2)
+	Output(ERROR, Root.stackLine("FATAL", 9, msg, args...))
+	Root.failAssert(msg, args...)
 }
 
+// Behavior of a failed assertion, the message with stack info is logged first in any mode
+type AssertMode int
+
+const (
+	// Exit the process with code 2
+	AssertExit AssertMode = iota
+	// Panic with the formatted message
+	AssertPanic
+	// Only log the message
+	AssertLog
+)
+
 // Log handle interface
 type Handle func(string, ...interface{})
 type HandleIf func(bool, string, ...interface{})
@@ -179,16 +494,82 @@ type HandleIf func(bool, string, ...interface{})
 // Log level
 type Level int
 
+// Marshal level as its string name
+func (l Level) MarshalJSON() ([]byte, error) {
+	if !validLevel(l) {
+		return nil, fmt.Errorf("invalid log level %d", int(l))
+	}
+	return json.Marshal(stringifyLevel(l))
+}
+
+// Unmarshal level from its string name
+func (l *Level) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	level, err := ParseLevelStrict(name)
+	if err == nil {
+		*l = level
+	}
+	return err
+}
+
 // Logger defines the logger instance
 type Logger struct {
-	// Current logger level
-	level Level
+	// Current *levelState of the logger
+	level atomic.Value
+	// Level handles muted by Mute, a bit per level, accessed atomically
+	muted uint32
 
 	// Logger writer instance
 	writer io.Writer
+	// Options of structured lines, a *loggerOptions swapped by Reconfigure
+	options atomic.Value
+	// Whether the TSV header was written
+	headerWritten bool
+	// Group path the fields of structured lines are nested under
+	group []string
+	// Pending write abandoned by WriteTimeout and count of dropped writes
+	pending chan struct{}
+	dropped uint64
+	// Filter of messages set by SetFilter, shared with derived loggers
+	filter atomic.Value
+	// Whether the writers were closed by Shutdown
+	closed bool
+	// Batch collecting the lines of a Logger.Batch call instead of writing them
+	batch *Batch
+	// Consecutive and last write failure of the writer
+	failures  int
+	lastError error
+	// Logger owning the writer of a derived logger, nil if the logger owns its writer
+	parent *Logger
+	// Name of a named logger
+	name string
+	// Sequence number of the last structured line
+	seq uint64
+	// Last emit time in unix nanos of LogEvery call sites, keyed by pc or message
+	every sync.Map
+	// Recent ERROR emissions of the logger and its derived loggers
+	errors errorCounter
 	// Logger writer lock to avoid race conditions
 	sync.Mutex
 
+	// Pending level restore of an active boost, guarded by boostLock
+	boost        *time.Timer
+	boostRestore *levelState
+	boostLock    sync.Mutex
+
+	// Clock provides timestamps of log lines, time.Now by default
+	Clock func() time.Time
+
+	// Behavior of failed assertions, AssertExit by default
+	AssertMode AssertMode
+
+	// Optional hook to rewrite each rendered line before it is written, e.g. to mask secrets.
+	// It runs on every line, so keep it cheap.
+	Redact func(string) string
+
 	// Logger handles
 	Trace, Debug, Verbose, Info, Warn, Error Handle
 
@@ -201,88 +582,711 @@ type Logger struct {
 func NewLogger(config *LogConfig) *Logger {
 	logger := &Logger{
 		writer: config.Writer(),
+		Clock:  time.Now,
 	}
-	logger.JsonIf = func(ok bool, level Level, v interface{}) { if ok { logger.Json(level, v) } }
-	logger.DumpIf = func(ok bool, level Level, v interface{}) { if ok { logger.Dump(level, v) } }
-
+	opts, _ := newOptions(config, func(c LogConfig) (io.Writer, error) { return c.Writer(), nil })
+	logger.options.Store(opts)
 	// Always set level as info for new logger
-	logger.SetLevel(INFO)
-	return logger
+	return logger.setup(INFO)
+}
+
+// Options of structured lines read once per line, never modified once published
+type loggerOptions struct {
+	// Config used to create the logger, nil for defaults
+	config *LogConfig
+	// Output format of structured lines
+	format OutputFormat
+	// Fields prepended to every structured line
+	fields []interface{}
+	// Log files of levels ordered by level descending, and recent output kept for crash dumps if enabled,
+	// only set for the logger owning the writer. The route writers are guarded by the writer lock.
+	routes []*levelRoute
+	crash  *RingBuffer
+}
+
+// Options of a logger without config
+var defaultOptions = &loggerOptions{}
+
+// Get the current options of the logger
+func (l *Logger) opts() *loggerOptions {
+	if opts, _ := l.options.Load().(*loggerOptions); opts != nil {
+		return opts
+	}
+	return defaultOptions
+}
+
+// Create the options of a config, with level route writers created by open
+func newOptions(config *LogConfig, open func(LogConfig) (io.Writer, error)) (*loggerOptions, error) {
+	opts := &loggerOptions{}
+	if config == nil {
+		return opts, nil
+	}
+	c := *config
+	opts.config = &c
+	opts.format = config.Format
+	if config.CrashBuffer > 0 {
+		opts.crash = NewRingBuffer(config.CrashBuffer)
+	}
+	if config.IncludeHost {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "unknown"
+		}
+		opts.fields = append(opts.fields, "host", host)
+	}
+	if config.IncludePID {
+		opts.fields = append(opts.fields, "pid", os.Getpid())
+	}
+	routes, err := config.levelRoutes(open)
+	opts.routes = routes
+	return opts, err
+}
+
+// Reconfigure replaces the config of the logger at runtime, e.g. on SIGHUP, closing the old writers afterwards.
+// The logger is left unchanged if the config level is invalid or a new log file can't be opened, including those
+// of LevelPaths. The level is reset to the config level, or INFO for a nil config. The options are swapped at once,
+// so concurrent lines see either the old or the new ones. Loggers derived before keep their own format and options
+// but write to the new writer.
+func (l *Logger) Reconfigure(config *LogConfig) error {
+	if l.parent != nil {
+		return fmt.Errorf("derived logger can not be reconfigured")
+	}
+	level := INFO
+	if config != nil {
+		level = config.Level
+	}
+	if !validLevel(level) {
+		return fmt.Errorf("invalid log level %d", level)
+	}
+	var writer io.Writer = os.Stderr
+	if config != nil && config.Path != "" {
+		w, err := NewFileWriter(*config)
+		if err != nil {
+			return err
+		}
+		writer = w
+	}
+	opts, err := newOptions(config, func(c LogConfig) (io.Writer, error) {
+		w, err := NewFileWriter(c)
+		if err != nil {
+			return nil, err
+		}
+		return w, nil
+	})
+	if err != nil {
+		closeWriter(writer)
+		return err
+	}
+
+	l.Lock()
+	old := append([]io.Writer{l.writer}, routeWriters(l.opts().routes)...)
+	for _, w := range sinkWriters(l.opts().config.sinks()) {
+		if !containsWriter(sinkWriters(config.sinks()), w) {
+			old = append(old, w)
+		}
+	}
+	l.writer = writer
+	l.options.Store(opts)
+	l.headerWritten, l.failures, l.lastError, l.closed = false, 0, nil, false
+	l.setLevel(level)
+	l.Unlock()
+	for _, w := range old {
+		closeWriter(w)
+	}
+	return nil
+}
+
+// Install the handles of a logger instance with the level
+func (l *Logger) setup(level Level) *Logger {
+	l.JsonIf = func(ok bool, level Level, v interface{}) { if ok { l.Json(level, v) } }
+	l.DumpIf = func(ok bool, level Level, v interface{}) { if ok { l.Dump(level, v) } }
+	for i, handle := range l.handles() {
+		*handle = l.wrap(Level(i))
+	}
+	for i, handle := range l.handleIfs() {
+		*handle = l.wrapIf(Level(i))
+	}
+	l.setLevel(level)
+	return l
+}
+
+// Named creates a child logger tagging structured lines with logger=name, or LogConfig.NameKey, nested names are joined with dots.
+// The child inherits the current level and follows the parent's level changes until its own SetLevel is called.
+func (l *Logger) Named(name string) *Logger {
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	child := l.derive()
+	child.name = name
+	child.level.Store(&levelState{follow: l})
+	return child
+}
+
+// With derives a logger prepending the key=value pairs to every structured line
+func (l *Logger) With(args ...interface{}) *Logger {
+	return l.derive(args...)
+}
+
+// SampleBy deterministically decides if the key, e.g. a request ID, is sampled at rate in [0, 1].
+// The same key is always sampled the same way, so sampled requests can log fully:
+//
+//	if logger.SampleBy(id, 0.01) { logger = logger.With("req", id) }
+func (l *Logger) SampleBy(key string, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// Mix the bits since fnv spreads similar keys poorly
+	v := h.Sum64()
+	v ^= v >> 33
+	v *= 0xff51afd7ed558ccd
+	v ^= v >> 33
+	v *= 0xc4ceb9fe1a85ec53
+	v ^= v >> 33
+	return float64(v) < rate*(1<<64)
+}
+
+// Group derives a logger emitting subsequent fields under the name namespace,
+// rendered as name.key= in text and as nested objects in json.
+func (l *Logger) Group(name string) *Logger {
+	child := l.derive()
+	child.group = append(l.group[:len(l.group):len(l.group)], name)
+	return child
+}
+
+// Field key nested under groups
+type groupKey struct {
+	path []string
+	key  string
+}
+
+func (k groupKey) String() string {
+	return strings.Join(k.path, ".") + "." + k.key
+}
+
+// Nest keys of key=value pairs under the logger group
+func (l *Logger) qualify(args []interface{}) []interface{} {
+	fields := make([]interface{}, len(args))
+	for i, arg := range args {
+		if i&1 == 0 {
+			arg = groupKey{path: l.group, key: FormatValue(arg)}
+		}
+		fields[i] = arg
+	}
+	return fields
+}
+
+// Derive a logger sharing the output of l with extra fields prepended to every structured line
+func (l *Logger) derive(fields ...interface{}) *Logger {
+	if len(l.group) > 0 {
+		fields = l.qualify(fields)
+	}
+	opts := l.opts()
+	child := &Logger{
+		group:  l.group,
+		parent: l.sink(),
+		name:   l.name,
+		Clock:  l.Clock,
+		Redact: l.Redact,
+		batch:  l.batch,
+
+		AssertMode: l.AssertMode,
+	}
+	child.options.Store(&loggerOptions{
+		config: opts.config,
+		format: opts.format,
+		fields: append(opts.fields[:len(opts.fields):len(opts.fields)], fields...),
+	})
+	return child.setup(l.Level())
+}
+
+// Get the logger owning the writer
+func (l *Logger) sink() *Logger {
+	if l.parent != nil {
+		return l.parent
+	}
+	return l
+}
+
+// Rendering of the level token of text lines
+type LevelFormat int
+
+const (
+	// Left aligned in 5 columns, e.g. "INFO "
+	LevelLeft LevelFormat = iota
+	// Right aligned in 5 columns, e.g. " INFO"
+	LevelRight
+	// Bracketed, e.g. "[INFO]"
+	LevelBracket
+)
+
+// Render the level label of text lines in the configured level format
+func (o *loggerOptions) levelLabel(label string) string {
+	format := LevelLeft
+	if o.config != nil {
+		format = o.config.LevelFormat
+	}
+	switch format {
+	case LevelRight:
+		return fmt.Sprintf("%5s", label)
+	case LevelBracket:
+		return "[" + label + "]"
+	default:
+		return fmt.Sprintf("%-5s", label)
+	}
 }
 
 // Time format used in loggers
 const TimeFormat = "06-01-02MST15:04:05.000"
 
+// Time formats of text and TSV lines with microsecond and nanosecond precision, padded to a fixed width
+const (
+	TimeFormatMicro = "06-01-02MST15:04:05.000000"
+	TimeFormatNano  = "06-01-02MST15:04:05.000000000"
+)
+
+// Format the time for text and TSV lines with LogConfig.TimeFormat, TimeFormat by default
+func (o *loggerOptions) timestamp(now time.Time) string {
+	if o.config != nil && o.config.TimeFormat != "" {
+		return now.Format(o.config.TimeFormat)
+	}
+	return now.Format(TimeFormat)
+}
+
 // Get the current logger level
 func (l *Logger) Level() Level {
-	return l.level
+	state, _ := l.level.Load().(*levelState)
+	if state == nil {
+		return TRACE
+	}
+	if state.follow != nil {
+		return state.follow.Level()
+	}
+	return state.level
+}
+
+// Level of a logger, or the logger whose level it follows
+type levelState struct {
+	level  Level
+	follow *Logger
 }
 
 // Assemble the log message and write into output
-func (l *Logger) write(level string, msg string, args ...interface{}) {
-	count := len(args)
-	for i := 1; i < count; i += 2 {
-		msg = fmt.Sprintf("%s	%s=%s", msg, FormatValue(args[i-1]), FormatValue(args[i]))
+func (l *Logger) write(level Level, msg string, args ...interface{}) {
+	if !l.sink().allow(level, msg) {
+		return
 	}
-	if count&1 == 1 {
-		msg = fmt.Sprintf("%-5s[%s] %s	%s=\n", level, time.Now().Format(TimeFormat), msg, FormatValue(args[count-1]))
+	opts := l.opts()
+	if msg == "" && opts.config != nil {
+		if len(args) == 0 && opts.config.SkipEmpty {
+			return
+		}
+		msg = opts.config.EmptyMessage
+	}
+	if len(l.group) > 0 {
+		args = l.qualify(args)
+	}
+	if l.name != "" || len(opts.fields) > 0 {
+		all := make([]interface{}, 0, len(opts.fields)+len(args)+4)
+		if l.name != "" {
+			key := "logger"
+			if opts.config != nil && opts.config.NameKey != "" {
+				key = opts.config.NameKey
+			}
+			all = append(all, key, l.name)
+		}
+		args = append(append(all, opts.fields...), args...)
+	}
+	if defaults := opts.config.levelFields(level); len(defaults) > 0 {
+		if len(args)&1 == 1 {
+			args = append(args, "")
+		}
+		args = append(args[:len(args):len(args)], defaults...)
+	}
+	if opts.config != nil && opts.config.SourceContext > 0 && level >= ERROR {
+		if src := sourceContext(opts.config.SourceContext); src != "" {
+			if len(args)&1 == 1 {
+				args = append(args, "")
+			}
+			args = append(args, "source", src)
+		}
+	}
+	if opts.config != nil && opts.config.FlattenMaps && opts.format != JSONFormat {
+		args = flattenMaps(args)
+	}
+	if opts.config != nil && len(opts.config.RedactKeys) > 0 {
+		args = redactFields(opts.config.RedactKeys, args)
+	}
+	if opts.config != nil && opts.config.MaxFields > 0 && len(args) > 2*opts.config.MaxFields {
+		dropped := (len(args)+1)/2 - opts.config.MaxFields
+		args = append(args[:2*opts.config.MaxFields:2*opts.config.MaxFields], "fields_truncated", dropped)
+	}
+	if opts.config != nil && opts.config.Sequence {
+		if len(args)&1 == 1 {
+			args = append(args, "")
+		}
+		args = append(args, "seq", atomic.AddUint64(&l.sink().seq, 1))
+	}
+	line := l.render(opts, opts.format, level, msg, args...)
+	o := l.sink()
+	o.errors.add(level, l.Clock())
+	sinkLines := o.sinkLines(func(format OutputFormat) []byte {
+		if format == opts.format {
+			return []byte(line)
+		}
+		return []byte(l.render(opts, format, level, msg, args...))
+	})
+	if l.batch != nil {
+		l.batch.add(o.route(level), level, []byte(line), opts.format == TSVFormat, sinkLines)
+		return
+	}
+	o.Lock()
+	if route := o.route(level); route != nil {
+		if opts.format == TSVFormat && !route.headerWritten {
+			o.emitRoute(route, noLevel, []byte(TSVHeader))
+			route.headerWritten = true
+		}
+		o.emitRoute(route, level, []byte(line))
 	} else {
-		msg = fmt.Sprintf("%-5s[%s] %s\n", level, time.Now().Format(TimeFormat), msg)
+		if opts.format == TSVFormat && !o.headerWritten {
+			o.emit(noLevel, []byte(TSVHeader))
+			o.headerWritten = true
+		}
+		o.emit(level, []byte(line))
 	}
-	l.Lock()
-	l.writer.Write([]byte(msg))
-	l.Unlock()
+	o.emitSinks(level, sinkLines)
+	if l.flushes(level) {
+		o.flushRoutes(o.route(level))
+	}
+	o.Unlock()
+}
+
+// Render the line of each output format of LogConfig.Sinks of the logger owning the writer, nil without sinks
+func (l *Logger) sinkLines(render func(OutputFormat) []byte) map[OutputFormat][]byte {
+	sinks := l.opts().config.sinks()
+	if len(sinks) == 0 {
+		return nil
+	}
+	lines := make(map[OutputFormat][]byte, len(sinks))
+	for _, sink := range sinks {
+		if _, ok := lines[sink.Format]; !ok {
+			lines[sink.Format] = render(sink.Format)
+		}
+	}
+	return lines
+}
+
+// Write the lines rendered by sinkLines into the sink writers, the caller must hold the writer lock.
+// Sinks added by a Reconfigure after the lines were rendered are skipped.
+func (l *Logger) emitSinks(level Level, lines map[OutputFormat][]byte) {
+	if len(lines) == 0 {
+		return
+	}
+	for _, sink := range l.opts().config.sinks() {
+		if line, ok := lines[sink.Format]; ok {
+			writeLevel(sink.Writer, level, line)
+		}
+	}
+}
+
+// Bytes reserved for each field key and value of text lines up front, a guess of their rendered length
+var FieldSizeHint = 16
+
+// Render a structured line in the output format
+func (l *Logger) render(opts *loggerOptions, format OutputFormat, level Level, msg string, args ...interface{}) string {
+	label := stringifyLevel(level)
+	switch format {
+	case TSVFormat:
+		msg = formatTSV(label, opts.timestamp(l.Clock()), msg, args...)
+	case JSONFormat:
+		var keys map[string]string
+		if opts.config != nil {
+			keys = opts.config.JSONKeys
+		}
+		msg = formatJSON(keys, label, l.Clock(), msg, args...)
+	case SyslogFormat:
+		app := ""
+		if opts.config != nil {
+			app = opts.config.AppName
+		}
+		msg = formatSyslog(level, app, l.Clock(), msg, args...)
+	default:
+		count := len(args)
+		sep := "\t"
+		if opts.config != nil && opts.config.MessageSeparator != "" {
+			sep = opts.config.MessageSeparator
+		}
+		var b strings.Builder
+		// Pre-size for the level, time, message and fields, to avoid growing the line while appending fields
+		b.Grow(len(msg) + 40 + count*FieldSizeHint)
+		b.WriteString(opts.levelLabel(label))
+		b.WriteByte('[')
+		b.WriteString(opts.timestamp(l.Clock()))
+		b.WriteString("] ")
+		b.WriteString(msg)
+		for i := 1; i < count; i += 2 {
+			b.WriteString(sep)
+			b.WriteString(FormatValue(args[i-1]))
+			b.WriteByte('=')
+			b.WriteString(FormatValue(args[i]))
+			sep = "\t"
+		}
+		if count&1 == 1 {
+			b.WriteString(sep)
+			b.WriteString(FormatValue(args[count-1]))
+			b.WriteByte('=')
+		}
+		b.WriteByte('\n')
+		msg = b.String()
+	}
+	if opts.config != nil && opts.config.EscapeNewlines {
+		token := opts.config.NewlineToken
+		if token == "" {
+			token = `\n`
+		}
+		msg = strings.ReplaceAll(msg[:len(msg)-1], "\n", token) + "\n"
+	}
+	if l.Redact != nil {
+		msg = l.Redact(msg)
+	}
+	return msg
+}
+
+// Get the level route of lines at the level, nil if they go to the logger writer
+func (l *Logger) route(level Level) *levelRoute {
+	for _, route := range l.opts().routes {
+		if level >= route.level {
+			return route
+		}
+	}
+	return nil
 }
 
 // Exit the process after the log message with stack info attached
 func (l *Logger) Fatal(msg string, args ...interface{}) {
-	l.Output(ERROR, StackInfo(9, msg, args...))
-	os.Exit(2)
+	l.fatal(2, msg, args...)
+}
+
+// Exit the process with the code after the log message with stack info attached, to tell failure classes apart
+func (l *Logger) FatalCode(code int, msg string, args ...interface{}) {
+	l.fatal(code, msg, args...)
+}
+
+func (l *Logger) fatal(code int, msg string, args ...interface{}) {
+	line := l.stackLine("FATAL", 11, msg, args...)
+	fatalOnce(func() {
+		l.Output(ERROR, line)
+		l.dumpCrash()
+		exit(code)
+	})
 }
 
 // Output a raw string with a custom level
 func (l *Logger) Output(level Level, msg string) {
-	if level < l.level {
+	if level = l.remap(level); level < l.Level() {
 		return
 	}
-	l.Write([]byte(msg), true)
+	l.writeRaw(level, []byte(msg))
 }
 
 // Output a raw string in format with a custom level, just like fmt.Printf with newline appended
 func (l *Logger) Outputf(level Level, msg string, args ...interface{}) {
-	if level < l.level {
+	if level = l.remap(level); level < l.Level() {
 		return
 	}
-	l.Write([]byte(fmt.Sprintf(msg, args...)), true)
+	l.writeRaw(level, []byte(fmt.Sprintf(msg, args...)))
 }
 
 // Output a log with custom level
 func (l *Logger) Log(level Level, msg string, args ...interface{}) {
-	if level < l.level {
+	if level = l.remap(level); level < l.Level() {
+		return
+	}
+	l.write(level, msg, args...)
+}
+
+// Output a log at most once per d for each call site, suppressing the calls in between, e.g. in hot loops
+func (l *Logger) LogEvery(d time.Duration, level Level, msg string, args ...interface{}) {
+	if level = l.remap(level); level < l.Level() {
 		return
 	}
-	l.write(stringifyLevel(level), msg, args...)
+	var key interface{} = msg
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		key = pc
+	}
+	now := l.Clock().UnixNano()
+	v, _ := l.sink().every.LoadOrStore(key, new(int64))
+	last := v.(*int64)
+	for {
+		prev := atomic.LoadInt64(last)
+		if prev != 0 && now-prev < int64(d) {
+			return
+		}
+		if atomic.CompareAndSwapInt64(last, prev, now) {
+			break
+		}
+	}
+	l.write(level, msg, args...)
+}
+
+// Call sites of Once which already logged in the process, keyed by pc or message
+var onceSeen sync.Map
+
+// Output a log only the first time the call site logs in the process, whichever logger calls it,
+// e.g. for deprecation warnings
+func (l *Logger) Once(level Level, msg string, args ...interface{}) {
+	if level = l.remap(level); level < l.Level() {
+		return
+	}
+	var key interface{} = msg
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		key = pc
+	}
+	if _, seen := onceSeen.LoadOrStore(key, true); seen {
+		return
+	}
+	l.write(level, msg, args...)
+}
+
+// Timer returns a closure logging msg with the args and a took= field of the time since Timer was called:
+//
+//	defer logger.Timer(INFO, "Handled request")("path", path)
+func (l *Logger) Timer(level Level, msg string) func(args ...interface{}) {
+	start := l.Clock()
+	return func(args ...interface{}) {
+		if len(args)&1 == 1 {
+			args = append(args, "")
+		}
+		l.Log(level, msg, append(args, "took", l.Clock().Sub(start))...)
+	}
+}
+
+// Create a handle of any level, including custom levels, checking the logger level on every call
+func (l *Logger) Handle(level Level) Handle {
+	return func(msg string, args ...interface{}) { l.Log(level, msg, args...) }
+}
+
+// Output a log with a level string, parsed by ParseLevel
+func (l *Logger) LogString(levelStr, msg string, args ...interface{}) {
+	l.Log(ParseLevel(levelStr), msg, args...)
+}
+
+// Render the level label and time of raw text lines, e.g. "INFO [...]"
+func (l *Logger) linePrefix(level Level) string {
+	opts := l.opts()
+	return opts.levelLabel(stringifyLevel(level)) + "[" + opts.timestamp(l.Clock()) + "]"
 }
 
 // Output any args just like fmt.Println
 func (l *Logger) Println(level Level, args ...interface{}) {
-	if level < l.level {
+	if level = l.remap(level); level < l.Level() {
 		return
 	}
-	msg := fmt.Sprintf("%-5s[%s]", stringifyLevel(level), time.Now().Format(TimeFormat))
+	msg := l.linePrefix(level)
 	for _, arg := range args {
 		msg = fmt.Sprintf("%s	%s", msg, FormatValue(arg))
 	}
-	l.Write([]byte(msg), true)
+	l.writeRaw(level, []byte(msg))
 }
 
 // Output a log message using string formatter with args
 func (l *Logger) Logf(level Level, msg string, args ...interface{}) {
-	if level < l.level {
+	if level = l.remap(level); level < l.Level() {
 		return
 	}
-	msg = fmt.Sprintf("%-5s[%s] %s", stringifyLevel(level), time.Now().Format(TimeFormat), msg)
-	l.Write([]byte(fmt.Sprintf(msg, args...)), true)
+	msg = fmt.Sprintf("%s %s", l.linePrefix(level), msg)
+	l.writeRaw(level, []byte(fmt.Sprintf(msg, args...)))
+}
+
+// Output an INFO message formatted exactly like fmt.Printf without level and time.
+// Like log.Printf of the standard library, a newline is appended only if missing.
+func (l *Logger) Printf(format string, args ...interface{}) {
+	if level := l.remap(INFO); level >= l.Level() {
+		l.writeRaw(level, []byte(strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")))
+	}
+}
+
+// Output a TRACE log message using string formatter with args
+func (l *Logger) Tracef(msg string, args ...interface{}) { l.Logf(TRACE, msg, args...) }
+
+// Output a DEBUG log message using string formatter with args
+func (l *Logger) Debugf(msg string, args ...interface{}) { l.Logf(DEBUG, msg, args...) }
+
+// Output a VERBOSE log message using string formatter with args
+func (l *Logger) Verbosef(msg string, args ...interface{}) { l.Logf(VERBOSE, msg, args...) }
+
+// Output an INFO log message using string formatter with args
+func (l *Logger) Infof(msg string, args ...interface{}) { l.Logf(INFO, msg, args...) }
+
+// Output a WARN log message using string formatter with args
+func (l *Logger) Warnf(msg string, args ...interface{}) { l.Logf(WARN, msg, args...) }
+
+// Output an ERROR log message using string formatter with args
+func (l *Logger) Errorf(msg string, args ...interface{}) { l.Logf(ERROR, msg, args...) }
+
+// Output a TRACE log of any variables, like fmt.Println
+func (l *Logger) Traceln(args ...interface{}) { l.Println(TRACE, args...) }
+
+// Output a DEBUG log of any variables, like fmt.Println
+func (l *Logger) Debugln(args ...interface{}) { l.Println(DEBUG, args...) }
+
+// Output a VERBOSE log of any variables, like fmt.Println
+func (l *Logger) Verboseln(args ...interface{}) { l.Println(VERBOSE, args...) }
+
+// Output an INFO log of any variables, like fmt.Println
+func (l *Logger) Infoln(args ...interface{}) { l.Println(INFO, args...) }
+
+// Output a WARN log of any variables, like fmt.Println
+func (l *Logger) Warnln(args ...interface{}) { l.Println(WARN, args...) }
+
+// Output an ERROR log of any variables, like fmt.Println
+func (l *Logger) Errorln(args ...interface{}) { l.Println(ERROR, args...) }
+
+// Output a log message with {name} placeholders substituted from fields, unused fields are appended as key=value.
+// Placeholders without a matching field are left as is.
+func (l *Logger) Tmpl(level Level, template string, fields map[string]interface{}) {
+	if level = l.remap(level); level < l.Level() {
+		return
+	}
+	var b strings.Builder
+	used := make(map[string]bool, len(fields))
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			break
+		}
+		name := template[start+1 : start+end]
+		b.WriteString(template[:start])
+		if value, ok := fields[name]; ok {
+			b.WriteString(Stringify(value))
+			used[name] = true
+		} else {
+			b.WriteString(template[start : start+end+1])
+		}
+		template = template[start+end+1:]
+	}
+	b.WriteString(template)
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		if !used[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	args := make([]interface{}, 0, len(keys)*2)
+	for _, key := range keys {
+		args = append(args, key, fields[key])
+	}
+	l.write(level, b.String(), args...)
 }
 
 // Assert a condition, fatal otherwise
@@ -290,75 +1294,440 @@ func (l *Logger) Assert(check bool, msg string, args ...interface{}) {
 	if check {
 		return
 	}
-	l.Output(ERROR, StackInfo(9, msg, args...))
-	os.Exit(2)
+	l.Output(ERROR, l.stackLine("FATAL", 9, msg, args...))
+	l.failAssert(msg, args...)
+}
+
+// Act on a failed assertion according to the assert mode
+func (l *Logger) failAssert(msg string, args ...interface{}) {
+	switch l.AssertMode {
+	case AssertPanic:
+		panic(Format(msg, args...))
+	case AssertLog:
+	default:
+		exit(2)
+	}
+}
+
+// Must logs the message with the error at ERROR and panics with the error wrapped if err is not nil.
+// Unlike Fatal, deferred calls and recovers still run, e.g. in init paths.
+func (l *Logger) Must(err error, msg string, args ...interface{}) {
+	if err == nil {
+		return
+	}
+	if len(args)&1 == 1 {
+		args = append(args, "")
+	}
+	l.Log(ERROR, msg, append(args, "err", err)...)
+	panic(fmt.Errorf("%s: %w", msg, err))
 }
 
-// Dump args as json
+// Dump args as json, struct fields tagged with log:"hex" or log:"redact" are rendered accordingly
 func (l *Logger) Json(level Level, arg interface{}) {
-	if level < l.level {
+	if level = l.remap(level); level < l.Level() {
 		return
 	}
-	bytes, err := json.Marshal(arg)
+	bytes, err := l.marshal(applyLogTags(arg))
 	if err != nil {
-		bytes = []byte(err.Error())
+		l.write(ERROR, "Failed to marshal json", "marshal_err", err)
+		return
+	}
+	l.writeRaw(level, bytes)
+}
+
+// Marshal a value as json with the values of LogConfig.RedactKeys masked
+func (l *Logger) marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if config := l.opts().config; err == nil && config != nil && len(config.RedactKeys) > 0 {
+		data, err = redactJSON(config.RedactKeys, data)
+	}
+	return data, err
+}
+
+// Output a log message with obj embedded as an obj= json field, marshaled only if the level is enabled
+func (l *Logger) Jsonw(level Level, msg string, obj interface{}) {
+	if level = l.remap(level); level < l.Level() {
+		return
+	}
+	bytes, err := l.marshal(obj)
+	if err != nil {
+		l.write(ERROR, "Failed to marshal json", "marshal_err", err)
+		return
+	}
+	l.write(level, msg, "obj", json.RawMessage(bytes))
+}
+
+// Write record as a single NDJSON line with the time and level fields merged in, regardless of the output format
+func (l *Logger) WriteJSON(level Level, record map[string]interface{}) {
+	if level = l.remap(level); level < l.Level() {
+		return
+	}
+	var keys map[string]string
+	if config := l.opts().config; config != nil {
+		keys = config.JSONKeys
+		if len(config.RedactKeys) > 0 {
+			record = redactRecord(config.RedactKeys, record)
+		}
+	}
+	l.writeRaw(level, formatRecord(keys, stringifyLevel(level), l.Clock(), record))
+}
+
+// Dump binary data in hex.Dump format under a label line, data beyond MaxHexDump bytes is truncated
+func (l *Logger) HexDump(level Level, label string, data []byte) {
+	if level = l.remap(level); level < l.Level() {
+		return
 	}
-	l.Write(bytes, true)
+	size := len(data)
+	if MaxHexDump > 0 && size > MaxHexDump {
+		data = data[:MaxHexDump]
+	}
+	msg := fmt.Sprintf("%s %s	size=%d\n%s", l.linePrefix(level), label, size, hex.Dump(data))
+	if len(data) < size {
+		msg = fmt.Sprintf("%s... %d more bytes\n", msg, size-len(data))
+	}
+	l.writeRaw(level, []byte(strings.TrimSuffix(msg, "\n")))
 }
 
-// Dump args as json with indent
+// Dump args as json with indent, honoring log struct tags like Json
 func (l *Logger) Dump(level Level, arg interface{}) {
-	if level < l.level {
+	if level = l.remap(level); level < l.Level() {
 		return
 	}
-	bytes, err := json.MarshalIndent(arg, "", "  ")
+	data, err := l.marshal(applyLogTags(arg))
 	if err != nil {
-		bytes = []byte(err.Error())
+		l.write(ERROR, "Failed to marshal json", "marshal_err", err)
+		return
+	}
+	var b bytes.Buffer
+	json.Indent(&b, data, "", "  ")
+	l.writeRaw(level, b.Bytes())
+}
+
+// Write a raw line of the level with newline appended
+func (l *Logger) writeRaw(level Level, bytes []byte) {
+	o := l.sink()
+	if !o.allow(level, string(bytes)) {
+		return
+	}
+	o.errors.add(level, l.Clock())
+	route := o.route(level)
+	l.writeTo(route, level, bytes, true)
+	if l.flushes(level) {
+		o.Lock()
+		o.flushRoutes(route)
+		o.Unlock()
+	}
+}
+
+// Check if lines of the level are flushed once written, see LogConfig.FlushLevel
+func (l *Logger) flushes(level Level) bool {
+	config := l.opts().config
+	return l.batch == nil && config != nil && config.FlushLevel > TRACE && level >= config.FlushLevel
+}
+
+// Flush the writers of the level routes, or the output writer for a nil route, and the sink writers.
+// The caller must hold the writer lock.
+func (l *Logger) flushRoutes(routes ...*levelRoute) {
+	var writers []io.Writer
+	for _, route := range routes {
+		if route != nil {
+			writers = append(writers, route.writer)
+		} else {
+			writers = append(writers, l.writer)
+		}
+	}
+	for _, w := range append(writers, sinkWriters(l.opts().config.sinks())...) {
+		if err := flushWriter(w); err != nil {
+			l.lastError = err
+		}
 	}
-	l.Write(bytes, true)
 }
 
 // Write will write bytes with optional '\n' directly into output writer
 func (l *Logger) Write(bytes []byte, newline bool) {
-	l.Lock()
-	l.writer.Write(bytes)
+	l.writeTo(nil, noLevel, bytes, newline)
+}
+
+// Write bytes of the level into the level route, or into output writer if route is nil
+func (l *Logger) writeTo(route *levelRoute, level Level, bytes []byte, newline bool) {
+	if l.Redact != nil {
+		bytes = []byte(l.Redact(string(bytes)))
+	}
 	if newline {
-		l.writer.Write([]byte("\n"))
+		// Emit the line in a single write, so record oriented writers see whole lines
+		bytes = append(bytes[:len(bytes):len(bytes)], '\n')
 	}
-	l.Unlock()
+	o := l.sink()
+	sinkLines := o.sinkLines(func(OutputFormat) []byte { return bytes })
+	if l.batch != nil {
+		l.batch.add(route, level, bytes, false, sinkLines)
+		return
+	}
+	o.Lock()
+	if route != nil {
+		o.emitRoute(route, level, bytes)
+	} else {
+		o.emit(level, bytes)
+	}
+	o.emitSinks(level, sinkLines)
+	o.Unlock()
+}
+
+// Write bytes of the level into the output writer tracking failures, the caller must hold the writer lock.
+// After MaxWriteFailures consecutive failures the log file is reopened, or output is discarded if that's not possible.
+func (l *Logger) emit(level Level, bytes []byte) {
+	if crash := l.opts().crash; crash != nil {
+		crash.Write(bytes)
+	}
+	err := l.writeOut(level, bytes)
+	if err == ErrWriteTimeout {
+		l.lastError = err
+		return
+	}
+	if err == nil {
+		l.failures = 0
+		return
+	}
+	l.lastError = err
+	l.failures++
+	if MaxWriteFailures <= 0 || l.failures < MaxWriteFailures {
+		return
+	}
+	l.failures = 0
+	// Closed in background since Close may wait for pending uploads, see UploadCloseTimeout
+	if closer, ok := l.writer.(io.Closer); ok && l.writer != os.Stderr {
+		go closer.Close()
+	}
+	l.writer = io.Discard
+	if config := l.opts().config; config != nil && config.Path != "" {
+		if w, err := NewFileWriter(*config); err == nil {
+			l.writer = w
+		}
+	}
+}
+
+// Write bytes of the level into the log file of a level route, the caller must hold the writer lock
+func (l *Logger) emitRoute(route *levelRoute, level Level, bytes []byte) {
+	if crash := l.opts().crash; crash != nil {
+		crash.Write(bytes)
+	}
+	writeLevel(route.writer, level, bytes)
+}
+
+// Write bytes into the output writer, giving up after WriteTimeout if set.
+// An abandoned write keeps running and writes after it are dropped until it returns.
+func (l *Logger) writeOut(level Level, bytes []byte) error {
+	config := l.opts().config
+	if config == nil || config.WriteTimeout <= 0 {
+		_, err := writeLevel(l.writer, level, bytes)
+		return err
+	}
+	if l.pending != nil {
+		select {
+		case <-l.pending:
+			l.pending = nil
+		default:
+			atomic.AddUint64(&l.dropped, 1)
+			return ErrWriteTimeout
+		}
+	}
+	var err error
+	done := make(chan struct{})
+	w := l.writer
+	go func() {
+		_, err = writeLevel(w, level, bytes)
+		close(done)
+	}()
+	timer := time.NewTimer(config.WriteTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return err
+	case <-timer.C:
+		l.pending = done
+		atomic.AddUint64(&l.dropped, 1)
+		return ErrWriteTimeout
+	}
+}
+
+// Count lines dropped by WriteTimeout
+func (l *Logger) Dropped() uint64 {
+	return atomic.LoadUint64(&l.sink().dropped)
+}
+
+// Get the last error returned by the output writer
+func (l *Logger) LastError() error {
+	o := l.sink()
+	o.Lock()
+	defer o.Unlock()
+	return o.lastError
+}
+
+// Rotate forces a rotation of the log file written by the logger, failing if the writer is not a FileWriter
+func (l *Logger) Rotate() error {
+	o := l.sink()
+	o.Lock()
+	defer o.Unlock()
+	w, ok := o.writer.(*FileWriter)
+	if !ok {
+		return fmt.Errorf("log writer does not support rotation")
+	}
+	err := w.ForceRotate()
+	for _, route := range o.opts().routes {
+		if w, ok := route.writer.(*FileWriter); ok {
+			if e := w.ForceRotate(); err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// Filter of log messages, returning false to suppress a message
+type Filter func(level Level, msg string) bool
+
+// SetFilter installs a filter consulted for every message passing the level threshold, e.g. to drop messages
+// matching a pattern. It's shared with derived loggers, nil allows all messages.
+func (l *Logger) SetFilter(filter func(level Level, msg string) bool) {
+	l.sink().filter.Store(Filter(filter))
+}
+
+// Check the message against the filter
+func (l *Logger) allow(level Level, msg string) bool {
+	filter, _ := l.filter.Load().(Filter)
+	return filter == nil || filter(level, msg)
 }
 
-// Create a handle with a level string for the logger instance
-func (l *Logger) wrap(level string) Handle {
-	return func(msg string, args ...interface{}) { l.write(level, msg, args...) }
+// Apply LogConfig.RemapLevel to the level of a call, before it's checked against the level threshold
+func (l *Logger) remap(level Level) Level {
+	if config := l.opts().config; config != nil && config.RemapLevel != nil {
+		return config.RemapLevel(level)
+	}
+	return level
+}
+
+// Create a handle with a level for the logger instance, checking the level at call time
+func (l *Logger) wrap(level Level) Handle {
+	return func(msg string, args ...interface{}) {
+		if level, ok := l.handled(level); ok {
+			l.write(level, msg, args...)
+		}
+	}
+}
+
+// Create a handle with a level for the logger instance, checking the level at call time
+func (l *Logger) wrapIf(level Level) HandleIf {
+	return func(ok bool, msg string, args ...interface{}) {
+		if level, enabled := l.handled(level); ok && enabled {
+			l.write(level, msg, args...)
+		}
+	}
 }
 
-// Create a handle with a level string for the logger instance
-func (l *Logger) wrapIf(level string) HandleIf {
-	return func(ok bool, msg string, args ...interface{}) { if ok { l.write(level, msg, args...) } }
+// Check if the level handle is not muted and its remapped level passes the threshold at call time,
+// so level changes never rewrite the handles
+func (l *Logger) handled(level Level) (Level, bool) {
+	if atomic.LoadUint32(&l.muted)&(1<<uint(level)) != 0 {
+		return level, false
+	}
+	level = l.remap(level)
+	return level, level >= l.Level()
 }
 
-// Set a level for a logger instance
+// Boost raises the logger to a more verbose level for the duration d and restores the previous level afterwards.
+// Overlapping boosts restart the timer and still restore the level active before the first boost.
+func (l *Logger) Boost(level Level, d time.Duration) {
+	l.boostLock.Lock()
+	defer l.boostLock.Unlock()
+	if l.boost == nil {
+		if level >= l.Level() {
+			return
+		}
+		l.boostRestore = l.level.Load().(*levelState)
+	} else {
+		l.boost.Stop()
+	}
+	l.storeLevel(level)
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		l.boostLock.Lock()
+		defer l.boostLock.Unlock()
+		if l.boost != timer {
+			return
+		}
+		l.boost = nil
+		l.level.Store(l.boostRestore)
+	})
+	l.boost = timer
+}
+
+// Set a level for a logger instance, a named logger stops following its parent's level afterwards
 func (l *Logger) SetLevel(target Level) {
-	if target < 0 || target > 5 {
+	l.setLevel(target)
+}
+
+// Set the logger level by name, e.g. from a reloaded config, returns an error and keeps the level for unknown names
+func (l *Logger) SetLevelString(name string) error {
+	level, err := ParseLevelStrict(name)
+	if err != nil {
+		return err
+	}
+	l.SetLevel(level)
+	return nil
+}
+
+// Apply a level to the logger, resetting the mutes
+func (l *Logger) setLevel(target Level) {
+	if !validLevel(target) {
 		target = INFO
 		l.Output(ERROR, "Invalid log level, will use INFO by default.")
 	}
-	l.level = target
-	handles := []*Handle{&l.Trace, &l.Debug, &l.Verbose, &l.Info, &l.Warn, &l.Error}
-	for i, handle := range handles {
-		if Level(i) >= target {
-			*handle = l.wrap(stringifyLevel(Level(i)))
-		} else {
-			*handle = discard
-		}
+	atomic.StoreUint32(&l.muted, 0)
+	l.storeLevel(target)
+}
+
+// Store the level of the logger, keeping the mutes. Named loggers following it read it on their next call.
+func (l *Logger) storeLevel(target Level) {
+	l.level.Store(&levelState{level: target})
+}
+
+// Mute discards messages of the level handles (Trace, TraceIf etc.) regardless of the level threshold.
+// Calling SetLevel afterwards resets all mutes.
+func (l *Logger) Mute(level Level) {
+	if level < 0 || level > ERROR {
+		return
 	}
-	handleIfs := []*HandleIf{&l.TraceIf, &l.DebugIf, &l.VerboseIf, &l.InfoIf, &l.WarnIf, &l.ErrorIf}
-	for i, handle := range handleIfs {
-		if Level(i) >= target {
-			*handle = l.wrapIf(stringifyLevel(Level(i)))
-		} else {
-			*handle = discardIf
+	l.mute(level, true)
+}
+
+// Unmute restores the level handles muted by Mute, they still apply the level threshold
+func (l *Logger) Unmute(level Level) {
+	if level < 0 || level > ERROR {
+		return
+	}
+	l.mute(level, false)
+}
+
+// Set or clear the mute bit of the level
+func (l *Logger) mute(level Level, muted bool) {
+	for {
+		old := atomic.LoadUint32(&l.muted)
+		bits := old &^ (1 << uint(level))
+		if muted {
+			bits = old | 1<<uint(level)
+		}
+		if atomic.CompareAndSwapUint32(&l.muted, old, bits) {
+			return
 		}
 	}
 }
+
+// Level handles of the logger indexed by level
+func (l *Logger) handles() []*Handle {
+	return []*Handle{&l.Trace, &l.Debug, &l.Verbose, &l.Info, &l.Warn, &l.Error}
+}
+
+// Level handleIfs of the logger indexed by level
+func (l *Logger) handleIfs() []*HandleIf {
+	return []*HandleIf{&l.TraceIf, &l.DebugIf, &l.VerboseIf, &l.InfoIf, &l.WarnIf, &l.ErrorIf}
+}
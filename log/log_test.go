@@ -1,8 +1,18 @@
 package log
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type Arg struct {
@@ -19,6 +29,9 @@ type B int
 func (b B) Hex() string { return "0x3333" }
 
 func TestLogger(t *testing.T) {
+	exit = func(int) {}
+	defer func() { exit = os.Exit }()
+
 	var b fmt.Stringer
 	var bb []byte
 	Output(INFO, "xxxxx")
@@ -46,3 +59,1346 @@ func TestLogger(t *testing.T) {
 	Fatal("Check fatal", "a", 1, "b", "xxx")
 	logger.Assert(false, "b", bb)
 }
+
+func TestBoost(t *testing.T) {
+	logger := NewLogger(nil)
+	logger.writer = io.Discard
+	// Lines logged while the boost reverts
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				logger.Debug("boosted")
+				logger.DebugFast("boosted")
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	logger.Boost(DEBUG, 20*time.Millisecond)
+	if logger.Level() != DEBUG {
+		t.Fatalf("expected boosted level DEBUG, got %s", stringifyLevel(logger.Level()))
+	}
+	// Overlapping boost keeps the original level to restore
+	logger.Boost(TRACE, 100*time.Millisecond)
+	if logger.Level() != TRACE {
+		t.Fatalf("expected boosted level TRACE, got %s", stringifyLevel(logger.Level()))
+	}
+	time.Sleep(30 * time.Millisecond)
+	if logger.Level() != TRACE {
+		t.Fatalf("boost reverted before the extended duration")
+	}
+	deadline := time.Now().Add(time.Second)
+	for logger.Level() != INFO && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if logger.Level() != INFO {
+		t.Fatalf("expected level to revert to INFO, got %s", stringifyLevel(logger.Level()))
+	}
+}
+
+func TestTSVFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{Format: TSVFormat})
+	logger.writer = &buf
+	logger.Info("first", "a", 1, "b", "x")
+	logger.Warn("second\tline", "odd")
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and two records, got %q", buf.String())
+	}
+	if lines[0]+"\n" != TSVHeader {
+		t.Fatalf("unexpected header %q", lines[0])
+	}
+	cols := strings.Split(lines[1], "\t")
+	if len(cols) != 4 || cols[1] != "INFO" || cols[2] != "first" || cols[3] != "a=1;b=x" {
+		t.Fatalf("unexpected columns %q", cols)
+	}
+	if _, err := time.Parse(TimeFormat, cols[0]); err != nil {
+		t.Fatalf("unexpected time column %q: %v", cols[0], err)
+	}
+	cols = strings.Split(lines[2], "\t")
+	if len(cols) != 4 || cols[1] != "WARN" || cols[2] != "second\\tline" || cols[3] != "odd=" {
+		t.Fatalf("unexpected columns %q", cols)
+	}
+}
+
+func TestTSVFieldEscape(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{Format: TSVFormat})
+	logger.writer = &buf
+	logger.Info("msg", "q=1;r", `a\b`, "k", "x=y;z\t")
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	cols := strings.Split(lines[len(lines)-1], "\t")
+	if len(cols) != 4 || cols[3] != `q\=1\;r=a\\b;k=x\=y\;z\t` {
+		t.Fatalf("unexpected fields cell %q", cols)
+	}
+}
+
+func TestJsonMarshalError(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.Json(INFO, make(chan int))
+	logger.Dump(INFO, make(chan int))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two lines, got %q", buf.String())
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "ERROR[") || !strings.Contains(line, "\tmarshal_err=json: unsupported type: chan int") {
+			t.Fatalf("unexpected marshal error line %q", line)
+		}
+	}
+}
+
+func deepStack(depth int, max int) string {
+	if depth > 0 {
+		return deepStack(depth-1, max)
+	}
+	MaxStackFrames = max
+	defer func() { MaxStackFrames = 0 }()
+	// Omit the goroutine header and the debug.Stack frame
+	return GetStackInfo(3)
+}
+
+func TestStackInfoMaxFrames(t *testing.T) {
+	info := deepStack(10, 4)
+	lines := strings.Split(strings.TrimSuffix(info, "\n"), "\n")
+	if len(lines) != 4*2+1 || lines[len(lines)-1] != "..." {
+		t.Fatalf("expected 4 frames and truncation marker, got %q", info)
+	}
+	if !strings.Contains(lines[0], "GetStackInfo") {
+		t.Fatalf("unexpected first frame %q", lines[0])
+	}
+	if info = deepStack(10, 100); strings.HasSuffix(info, "...\n") {
+		t.Fatalf("unexpected truncation of short stack %q", info)
+	}
+}
+
+func TestStackInfoCompact(t *testing.T) {
+	StackInfoFormat = StackCompact
+	defer func() { StackInfoFormat = StackFull }()
+	info := deepStack(10, 4)
+	lines := strings.Split(strings.TrimSuffix(info, "\n"), "\n")
+	if len(lines) != 4+1 || lines[len(lines)-1] != "..." {
+		t.Fatalf("expected 4 frames and truncation marker, got %q", info)
+	}
+	frame := regexp.MustCompile(`^\S+ \(\S+\.go:\d+\)$`)
+	for _, line := range lines[:4] {
+		if !frame.MatchString(line) {
+			t.Fatalf("unexpected compact frame %q", line)
+		}
+	}
+	if !strings.Contains(lines[0], "GetStackInfo") || !strings.Contains(lines[1], "deepStack") {
+		t.Fatalf("unexpected first frames %q", lines[:2])
+	}
+	if info = GetStackInfo(3); !strings.Contains(info, "TestStackInfoCompact") || strings.HasSuffix(info, "...\n") {
+		t.Fatalf("unexpected full compact stack %q", info)
+	}
+}
+
+func TestLevelJSON(t *testing.T) {
+	for i, name := range Levels {
+		level := Level(i)
+		data, err := json.Marshal(level)
+		if err != nil {
+			t.Fatalf("failed to marshal level %s: %v", name, err)
+		}
+		if string(data) != `"`+name+`"` {
+			t.Fatalf("unexpected marshaled level %s", data)
+		}
+		var parsed Level
+		if err = json.Unmarshal(data, &parsed); err != nil || parsed != level {
+			t.Fatalf("failed to unmarshal level %s: %v", data, err)
+		}
+	}
+	var parsed Level
+	if err := json.Unmarshal([]byte(`"bogus"`), &parsed); err == nil {
+		t.Fatalf("expected error for invalid level")
+	}
+	if _, err := json.Marshal(Level(100)); err == nil {
+		t.Fatalf("expected error for out of range level")
+	}
+}
+
+func TestTmpl(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.Tmpl(INFO, "user {user} logged in from {ip}", map[string]interface{}{"user": "bob", "ip": "10.0.0.1", "id": 7, "attempt": 2})
+	if line := buf.String(); !strings.HasSuffix(line, "] user bob logged in from 10.0.0.1\tattempt=2\tid=7\n") {
+		t.Fatalf("unexpected template output %q", line)
+	}
+	buf.Reset()
+	logger.Tmpl(WARN, "missing {user} and {", map[string]interface{}{"id": 7})
+	if line := buf.String(); !strings.HasSuffix(line, "] missing {user} and {\tid=7\n") {
+		t.Fatalf("unexpected template output %q", line)
+	}
+	buf.Reset()
+	logger.Tmpl(DEBUG, "skipped {user}", nil)
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected output below level %q", buf.String())
+	}
+}
+
+func TestRedact(t *testing.T) {
+	var buf bytes.Buffer
+	email := regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.]+`)
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.Redact = func(line string) string { return email.ReplaceAllString(line, "***") }
+	logger.Info("Sent mail", "to", "bob@example.com")
+	logger.Output(INFO, "raw alice@example.org")
+	if out := buf.String(); strings.Contains(out, "@") || !strings.Contains(out, "to=***\n") || !strings.HasSuffix(out, "raw ***\n") {
+		t.Fatalf("unexpected redacted output %q", out)
+	}
+}
+
+func TestLeveledPrintf(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.SetLevel(TRACE)
+	handles := []func(string, ...interface{}){logger.Tracef, logger.Debugf, logger.Verbosef, logger.Infof, logger.Warnf, logger.Errorf}
+	for i, handle := range handles {
+		buf.Reset()
+		handle("value %d of %s", i, "x")
+		expected := fmt.Sprintf("%-5s[", Levels[i])
+		if out := buf.String(); !strings.HasPrefix(out, expected) || !strings.HasSuffix(out, fmt.Sprintf("] value %d of x\n", i)) {
+			t.Fatalf("unexpected output for level %s: %q", Levels[i], out)
+		}
+	}
+	logger.SetLevel(WARN)
+	buf.Reset()
+	logger.Infof("hidden %d", 1)
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected output below level %q", buf.String())
+	}
+}
+
+func TestLeveledPrintln(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.SetLevel(TRACE)
+	handles := []func(...interface{}){logger.Traceln, logger.Debugln, logger.Verboseln, logger.Infoln, logger.Warnln, logger.Errorln}
+	for i, handle := range handles {
+		buf.Reset()
+		handle("value", i)
+		expected := fmt.Sprintf("%-5s[", Levels[i])
+		if out := buf.String(); !strings.HasPrefix(out, expected) || !strings.HasSuffix(out, fmt.Sprintf("]\tvalue\t%d\n", i)) {
+			t.Fatalf("unexpected output for level %s: %q", Levels[i], out)
+		}
+	}
+
+	defer SetRootForTest(logger)()
+	buf.Reset()
+	Warnln("global", 1)
+	if out := buf.String(); !strings.HasPrefix(out, "WARN [") || !strings.HasSuffix(out, "]\tglobal\t1\n") {
+		t.Fatalf("unexpected global output %q", out)
+	}
+}
+
+func TestMute(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.SetLevel(DEBUG)
+	logger.Mute(VERBOSE)
+	logger.Debug("debug")
+	logger.Verbose("verbose")
+	logger.VerboseIf(true, "verbose if")
+	logger.Info("info")
+	if out := buf.String(); strings.Contains(out, "verbose") || !strings.Contains(out, "debug") || !strings.Contains(out, "info") {
+		t.Fatalf("unexpected output with muted level %q", out)
+	}
+	logger.Unmute(VERBOSE)
+	buf.Reset()
+	logger.Verbose("verbose")
+	if !strings.Contains(buf.String(), "verbose") {
+		t.Fatalf("expected output after unmute")
+	}
+	logger.Mute(VERBOSE)
+	logger.SetLevel(DEBUG)
+	buf.Reset()
+	logger.Verbose("verbose")
+	if !strings.Contains(buf.String(), "verbose") {
+		t.Fatalf("expected SetLevel to reset mutes")
+	}
+	logger.SetLevel(INFO)
+	logger.Unmute(DEBUG)
+	buf.Reset()
+	logger.Debug("debug")
+	if buf.Len() != 0 {
+		t.Fatalf("unmute should not bypass the level threshold")
+	}
+}
+
+func TestClock(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.Clock = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 890000000, time.UTC) }
+	logger.Info("frozen", "a", 1)
+	logger.Logf(WARN, "frozen %d", 2)
+	logger.Println(ERROR, "frozen", 3)
+	expected := "INFO [21-03-04UTC05:06:07.890] frozen\ta=1\n" +
+		"WARN [21-03-04UTC05:06:07.890] frozen 2\n" +
+		"ERROR[21-03-04UTC05:06:07.890]\tfrozen\t3\n"
+	if out := buf.String(); out != expected {
+		t.Fatalf("unexpected output with frozen clock %q", out)
+	}
+}
+
+func TestIncludeHostPID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{IncludeHost: true, IncludePID: true})
+	logger.writer = &buf
+	logger.Info("tagged", "a", 1)
+	host, _ := os.Hostname()
+	expected := fmt.Sprintf("] tagged\thost=%s\tpid=%d\ta=1\n", host, os.Getpid())
+	if out := buf.String(); !strings.HasSuffix(out, expected) {
+		t.Fatalf("unexpected output %q, expected suffix %q", out, expected)
+	}
+}
+
+type failingWriter struct{ calls int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.calls++
+	return 0, errors.New("bad file descriptor")
+}
+
+func TestWriteFailureFallback(t *testing.T) {
+	w := &failingWriter{}
+	logger := NewLogger(nil)
+	logger.writer = w
+	for i := 0; i < MaxWriteFailures; i++ {
+		logger.Info("lost")
+	}
+	if err := logger.LastError(); err == nil || err.Error() != "bad file descriptor" {
+		t.Fatalf("unexpected last error %v", err)
+	}
+	if logger.writer != io.Discard {
+		t.Fatalf("expected fallback to discard writer")
+	}
+	logger.Info("discarded")
+	if w.calls != MaxWriteFailures {
+		t.Fatalf("failing writer still used after fallback")
+	}
+
+	path := t.TempDir() + "/fallback.log"
+	logger = NewLogger(&LogConfig{Path: path})
+	logger.writer.(*FileWriter).Close()
+	logger.writer = &failingWriter{}
+	for i := 0; i < MaxWriteFailures; i++ {
+		logger.Info("lost")
+	}
+	logger.Info("recovered")
+	logger.writer.(*FileWriter).Close()
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "recovered") {
+		t.Fatalf("expected log file to be reopened, got %q err %v", data, err)
+	}
+}
+
+// Failing writer whose Close blocks until release is closed
+type hangingCloser struct {
+	failingWriter
+	release chan bool
+}
+
+func (w *hangingCloser) Close() error { <-w.release; return nil }
+
+func TestWriteFailureSlowClose(t *testing.T) {
+	w := &hangingCloser{release: make(chan bool)}
+	defer close(w.release)
+	logger := NewLogger(nil)
+	logger.writer = w
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < MaxWriteFailures; i++ {
+			logger.Info("lost")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected logging not to wait for the failing writer to close")
+	}
+}
+
+func TestEmptyMessage(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{SkipEmpty: true, EmptyMessage: "-"})
+	logger.writer = &buf
+	logger.Info("")
+	logger.Log(WARN, "")
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected output of empty calls %q", buf.String())
+	}
+	logger.Info("", "a", 1)
+	if out := buf.String(); !strings.HasSuffix(out, "] -\ta=1\n") {
+		t.Fatalf("unexpected output of empty message with fields %q", out)
+	}
+
+	buf.Reset()
+	logger = NewLogger(nil)
+	logger.writer = &buf
+	logger.Info("")
+	if out := buf.String(); !strings.HasSuffix(out, "] \n") {
+		t.Fatalf("unexpected default output of empty call %q", out)
+	}
+}
+
+func TestNamedLevelInheritance(t *testing.T) {
+	var buf bytes.Buffer
+	parent := NewLogger(nil)
+	parent.writer = &buf
+	parent.SetLevel(WARN)
+	child := parent.Named("db")
+	grandchild := child.Named("pool")
+	if child.Level() != WARN || grandchild.Level() != WARN {
+		t.Fatalf("expected children to inherit level WARN")
+	}
+	parent.SetLevel(DEBUG)
+	if child.Level() != DEBUG || grandchild.Level() != DEBUG {
+		t.Fatalf("expected children to follow parent level DEBUG")
+	}
+	child.Debug("query", "id", 1)
+	if out := buf.String(); !strings.HasSuffix(out, "] query\tlogger=db\tid=1\n") {
+		t.Fatalf("unexpected child output %q", out)
+	}
+	child.SetLevel(ERROR)
+	parent.SetLevel(INFO)
+	if child.Level() != ERROR || grandchild.Level() != ERROR {
+		t.Fatalf("expected detached child to keep its own level")
+	}
+	buf.Reset()
+	grandchild.Error("closed")
+	if out := buf.String(); !strings.HasSuffix(out, "] closed\tlogger=db.pool\n") {
+		t.Fatalf("unexpected grandchild output %q", out)
+	}
+
+	// Level changes race with named loggers created and logging concurrently
+	parent.writer = io.Discard
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			parent.Named("req").Debug("request", "i", i)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		parent.SetLevel(Level(i % 2))
+	}
+	wg.Wait()
+	parent.Boost(TRACE, time.Hour)
+	if named := parent.Named("late"); named.Level() != TRACE {
+		t.Fatalf("expected named logger to follow the boosted level")
+	}
+}
+
+func TestLogString(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.LogString("warn", "bridged", "src", "syslog")
+	if out := buf.String(); !strings.HasPrefix(out, "WARN [") || !strings.HasSuffix(out, "] bridged\tsrc=syslog\n") {
+		t.Fatalf("unexpected output %q", out)
+	}
+	buf.Reset()
+	logger.LogString("debug", "hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected output below level %q", buf.String())
+	}
+}
+
+func TestGroup(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.Group("req").Ctx(WithTraceID(context.Background(), "t1")).Group("http").Info("served", "status", 200)
+	if out := buf.String(); !strings.HasSuffix(out, "] served\treq.trace_id=t1\treq.http.status=200\n") {
+		t.Fatalf("unexpected grouped text output %q", out)
+	}
+
+	buf.Reset()
+	logger = NewLogger(&LogConfig{Format: JSONFormat})
+	logger.writer = &buf
+	logger.Clock = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC) }
+	logger.Info("top", "a", 1)
+	logger.Group("req").Ctx(WithTraceID(context.Background(), "t1")).Group("http").Info("served", "status", 200, "path", "/")
+	expected := `{"time":"2021-03-04T05:06:07Z","level":"INFO","msg":"top","a":1}` + "\n" +
+		`{"time":"2021-03-04T05:06:07Z","level":"INFO","msg":"served","req":{"trace_id":"t1","http":{"status":200,"path":"/"}}}` + "\n"
+	if out := buf.String(); out != expected {
+		t.Fatalf("unexpected grouped json output %q", out)
+	}
+}
+
+func TestStrictLevelEnv(t *testing.T) {
+	defer Init(nil)
+	t.Setenv("LOG_LEVEL", "bogus")
+	root := Root
+	if err := InitStrict(nil); err == nil || Root != root {
+		t.Fatalf("expected error for invalid LOG_LEVEL keeping Root, got %v", err)
+	}
+	if err := InitStrict(&LogConfig{Level: ERROR}); err != nil || Root.Level() != ERROR {
+		t.Fatalf("expected LOG_LEVEL ignored with config, got %v level %d", err, Root.Level())
+	}
+	t.Setenv("LOG_LEVEL", "warn")
+	if err := InitStrict(nil); err != nil || Root.Level() != WARN {
+		t.Fatalf("unexpected strict init result %v level %d", err, Root.Level())
+	}
+
+	t.Setenv("LOG_LEVEL", "bogus")
+	t.Setenv("LOG_LEVEL_STRICT", "1")
+	path := t.TempDir() + "/strict.log"
+	Init(&LogConfig{Path: path, Level: INFO})
+	Root.writer.(*FileWriter).Close()
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Fatalf("expected no warning about unused env, got %q", data)
+	}
+	stderr, err := os.Create(t.TempDir() + "/stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(f *os.File) { os.Stderr = f }(os.Stderr)
+	os.Stderr = stderr
+	Init(nil)
+	stderr.Close()
+	if data, _ := os.ReadFile(stderr.Name()); !strings.Contains(string(data), "WARN [") || !strings.Contains(string(data), `err=invalid log level "bogus"`) {
+		t.Fatalf("expected warning about invalid env, got %q", data)
+	}
+}
+
+func TestSampleBy(t *testing.T) {
+	logger := NewLogger(nil)
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("req-%d", i)
+		ok := logger.SampleBy(key, 0.1)
+		if ok != logger.SampleBy(key, 0.1) {
+			t.Fatalf("sampling of %s is not deterministic", key)
+		}
+		if ok && !logger.SampleBy(key, 0.5) {
+			t.Fatalf("key %s sampled at 0.1 should be sampled at a higher rate", key)
+		}
+		if ok {
+			sampled++
+		}
+	}
+	if sampled < 800 || sampled > 1200 {
+		t.Fatalf("unexpected sampled count %d for rate 0.1", sampled)
+	}
+	if logger.SampleBy("req-1", 0) || !logger.SampleBy("req-1", 1) {
+		t.Fatalf("unexpected sampling at rate bounds")
+	}
+
+	var buf bytes.Buffer
+	logger.writer = &buf
+	logger.With("req", "r1").Info("sampled", "a", 1)
+	if out := buf.String(); !strings.HasSuffix(out, "] sampled\treq=r1\ta=1\n") {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
+
+func TestAssertMode(t *testing.T) {
+	var buf bytes.Buffer
+	code := 0
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+	logger := NewLogger(nil)
+	logger.writer = &buf
+
+	logger.Assert(false, "exit mode", "a", 1)
+	if code != 2 || !strings.HasPrefix(buf.String(), "FATAL[") {
+		t.Fatalf("expected exit code 2 after logging, got %d %q", code, buf.String())
+	}
+
+	code = 0
+	buf.Reset()
+	logger.AssertMode = AssertLog
+	logger.Assert(false, "log mode")
+	if code != 0 || !strings.Contains(buf.String(), "log mode") {
+		t.Fatalf("expected log only, got code %d %q", code, buf.String())
+	}
+
+	logger.AssertMode = AssertPanic
+	func() {
+		defer func() {
+			if r := recover(); r != "panic mode\ta=1" {
+				t.Fatalf("unexpected panic %v", r)
+			}
+		}()
+		logger.Assert(false, "panic mode", "a", 1)
+	}()
+	if code != 0 {
+		t.Fatalf("unexpected exit in panic mode")
+	}
+	logger.Assert(true, "passed")
+}
+
+func TestRegisterLevel(t *testing.T) {
+	defer func() { Levels = Levels[:6] }()
+	SECURITY := Level(8)
+	if err := RegisterLevel("security", SECURITY); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := RegisterLevel("audit", Level(7)); err == nil {
+		t.Fatalf("expected error for level below existing levels")
+	}
+	if err := RegisterLevel("warn", Level(9)); err == nil {
+		t.Fatalf("expected error for duplicated level")
+	}
+	if err := RegisterLevel("verylongname", Level(9)); err == nil {
+		t.Fatalf("expected error for too long level name")
+	}
+	if level, err := ParseLevelStrict("security"); err != nil || level != SECURITY {
+		t.Fatalf("unexpected parsed level %d %v", level, err)
+	}
+	if _, err := ParseLevelStrict(""); err == nil {
+		t.Fatalf("unexpected match of level gap")
+	}
+
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.Log(SECURITY, "login failed", "user", "bob")
+	logger.Handle(SECURITY)("token reused")
+	logger.SetLevel(SECURITY)
+	logger.Error("hidden")
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "SECURITY[") || !strings.HasSuffix(lines[1], "] token reused") {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+	if data, err := json.Marshal(SECURITY); err != nil || string(data) != `"SECURITY"` {
+		t.Fatalf("unexpected json level %s %v", data, err)
+	}
+}
+
+type countingMarshaler struct{ calls *int }
+
+func (m countingMarshaler) MarshalJSON() ([]byte, error) {
+	*m.calls++
+	return []byte(`{"a":1}`), nil
+}
+
+func TestJsonw(t *testing.T) {
+	var buf bytes.Buffer
+	calls := 0
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.Jsonw(DEBUG, "skipped", countingMarshaler{&calls})
+	if calls != 0 || buf.Len() != 0 {
+		t.Fatalf("expected marshaling to be skipped below level")
+	}
+	logger.Jsonw(INFO, "request", countingMarshaler{&calls})
+	if out := buf.String(); calls != 1 || !strings.HasSuffix(out, "] request\tobj={\"a\":1}\n") {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	buf.Reset()
+	logger = NewLogger(&LogConfig{Format: JSONFormat})
+	logger.writer = &buf
+	logger.Jsonw(INFO, "request", countingMarshaler{&calls})
+	if out := buf.String(); !strings.HasSuffix(out, `"msg":"request","obj":{"a":1}}`+"\n") {
+		t.Fatalf("unexpected json output %q", out)
+	}
+}
+
+func TestHexDump(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.Clock = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC) }
+	logger.HexDump(INFO, "packet", []byte("hello, world!"))
+	expected := "INFO [21-03-04UTC05:06:07.000] packet\tsize=13\n" +
+		"00000000  68 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21           |hello, world!|\n"
+	if out := buf.String(); out != expected {
+		t.Fatalf("unexpected dump %q", out)
+	}
+
+	defer func(max int) { MaxHexDump = max }(MaxHexDump)
+	MaxHexDump = 4
+	buf.Reset()
+	logger.HexDump(WARN, "truncated", []byte("hello, world!"))
+	expected = "WARN [21-03-04UTC05:06:07.000] truncated\tsize=13\n" +
+		"00000000  68 65 6c 6c                                       |hell|\n" +
+		"... 9 more bytes\n"
+	if out := buf.String(); out != expected {
+		t.Fatalf("unexpected truncated dump %q", out)
+	}
+	buf.Reset()
+	logger.HexDump(DEBUG, "hidden", []byte("x"))
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected dump below level")
+	}
+}
+
+func TestSequence(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{Sequence: true})
+	logger.writer = &buf
+	logger.Info("first")
+	logger.With("a", 1).Warn("second", "b", 2)
+	logger.Info("third", "odd")
+	expected := []string{"] first\tseq=1", "] second\ta=1\tb=2\tseq=2", "] third\todd=\tseq=3"}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, expected[i]) {
+			t.Fatalf("unexpected line %q, expected suffix %q", line, expected[i])
+		}
+	}
+}
+
+func TestFlattenMaps(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{FlattenMaps: true})
+	logger.writer = &buf
+	req := map[string]interface{}{
+		"path":   "/",
+		"header": map[string]interface{}{"host": "a.com", "agent": "curl"},
+	}
+	logger.Info("request", "req", req, "id", 1)
+	if out := buf.String(); !strings.HasSuffix(out, "] request\treq.header.agent=curl\treq.header.host=a.com\treq.path=/\tid=1\n") {
+		t.Fatalf("unexpected flattened output %q", out)
+	}
+
+	buf.Reset()
+	deep := map[string]interface{}{"v": 1}
+	for i := 0; i < 5; i++ {
+		deep = map[string]interface{}{"n": deep}
+	}
+	logger.Info("deep", "d", deep)
+	if out := buf.String(); !strings.HasSuffix(out, "] deep\td.n.n.n.n=map[n:map[v:1]]\n") {
+		t.Fatalf("unexpected bounded flattening %q", out)
+	}
+}
+
+func TestLogEvery(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	logger.Clock = func() time.Time { return now }
+	for i := 0; i < 5; i++ {
+		logger.LogEvery(time.Second, INFO, "tick", "i", i)
+		now = now.Add(300 * time.Millisecond)
+	}
+	logger.LogEvery(time.Second, INFO, "other")
+	expected := []string{"] tick\ti=0", "] tick\ti=4", "] other"}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, expected[i]) {
+			t.Fatalf("unexpected line %q, expected suffix %q", line, expected[i])
+		}
+	}
+}
+
+func TestFatalCode(t *testing.T) {
+	var buf bytes.Buffer
+	code := 0
+	exit = func(c int) { code = c }
+	defer func() { exit = os.Exit }()
+	logger := NewLogger(nil)
+	logger.writer = &buf
+
+	logger.FatalCode(3, "bad config", "a", 1)
+	out := buf.String()
+	if code != 3 || !strings.HasPrefix(out, "FATAL[") || !strings.Contains(out, "bad config\ta=1") {
+		t.Fatalf("unexpected fatal code %d %q", code, out)
+	}
+	if lines := strings.Split(out, "\n"); len(lines) < 2 || !strings.Contains(lines[1], "TestFatalCode") {
+		t.Fatalf("expected stack starting at the caller, got %q", out)
+	}
+	logger.Fatal("fatal")
+	if code != 2 {
+		t.Fatalf("expected exit code 2 of Fatal, got %d", code)
+	}
+}
+
+func TestJSONKeys(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{Format: JSONFormat, JSONKeys: map[string]string{"msg": "message", "time": "ts"}})
+	logger.writer = &buf
+	logger.Clock = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC) }
+	logger.Info("renamed", "a", 1)
+	expected := `{"ts":"2021-03-04T05:06:07Z","level":"INFO","message":"renamed","a":1}` + "\n"
+	if out := buf.String(); out != expected {
+		t.Fatalf("unexpected json output %q", out)
+	}
+}
+
+func TestMust(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.Must(nil, "no error")
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected output of nil error %q", buf.String())
+	}
+
+	cause := errors.New("bad port")
+	func() {
+		defer func() {
+			err, ok := recover().(error)
+			if !ok || !errors.Is(err, cause) || err.Error() != "load config: bad port" {
+				t.Fatalf("unexpected panic %v", err)
+			}
+		}()
+		logger.Must(cause, "load config", "file", "a.yml")
+	}()
+	if out := buf.String(); !strings.HasPrefix(out, "ERROR[") || !strings.HasSuffix(out, "] load config\tfile=a.yml\terr=bad port\n") {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
+
+func TestMaxFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{MaxFields: 2})
+	logger.writer = &buf
+	logger.With("a", 1).Info("fields", "b", 2, "c", 3, "d")
+	if out := buf.String(); !strings.HasSuffix(out, "] fields\ta=1\tb=2\tfields_truncated=2\n") {
+		t.Fatalf("unexpected truncated output %q", out)
+	}
+	buf.Reset()
+	logger.Info("fields", "a", 1, "b", 2)
+	if out := buf.String(); !strings.HasSuffix(out, "] fields\ta=1\tb=2\n") {
+		t.Fatalf("unexpected output within the limit %q", out)
+	}
+}
+
+func TestEscapeNewlines(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{EscapeNewlines: true})
+	logger.writer = &buf
+	logger.Info("multi\nline", "trace", errors.New("a\nb"))
+	if out := buf.String(); strings.Count(out, "\n") != 1 || !strings.HasSuffix(out, `] multi\nline	trace=a\nb`+"\n") {
+		t.Fatalf("unexpected escaped output %q", out)
+	}
+
+	buf.Reset()
+	logger = NewLogger(&LogConfig{EscapeNewlines: true, NewlineToken: " | "})
+	logger.writer = &buf
+	logger.Info("multi\nline", "k", 1)
+	if out := buf.String(); !strings.HasSuffix(out, "] multi | line\tk=1\n") {
+		t.Fatalf("unexpected output with custom token %q", out)
+	}
+}
+
+// Writer blocking until released
+type slowWriter struct {
+	release chan bool
+	bytes.Buffer
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.Buffer.Write(p)
+}
+
+func TestWriteTimeout(t *testing.T) {
+	w := &slowWriter{release: make(chan bool)}
+	logger := NewLogger(&LogConfig{WriteTimeout: 20 * time.Millisecond})
+	logger.writer = w
+	start := time.Now()
+	logger.Info("slow")
+	logger.Info("dropped")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("caller blocked for %v", elapsed)
+	}
+	if logger.Dropped() != 2 || logger.LastError() != ErrWriteTimeout {
+		t.Fatalf("expected 2 dropped writes, got %d %v", logger.Dropped(), logger.LastError())
+	}
+	close(w.release)
+	<-logger.pending
+	logger.Info("resumed")
+	if out := w.String(); !strings.Contains(out, "] slow\n") || strings.Contains(out, "dropped") || !strings.HasSuffix(out, "] resumed\n") {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
+
+func TestLevelFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{LevelFormat: LevelBracket})
+	logger.writer = &buf
+	logger.Clock = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC) }
+	logger.Info("bracketed", "a", 1)
+	logger.Println(WARN, "raw")
+	logger.Logf(ERROR, "printf %d", 1)
+	expected := "[INFO][21-03-04UTC05:06:07.000] bracketed\ta=1\n" +
+		"[WARN][21-03-04UTC05:06:07.000]\traw\n" +
+		"[ERROR][21-03-04UTC05:06:07.000] printf 1\n"
+	if out := buf.String(); out != expected {
+		t.Fatalf("unexpected bracketed output %q", out)
+	}
+
+	buf.Reset()
+	logger = NewLogger(&LogConfig{LevelFormat: LevelRight})
+	logger.writer = &buf
+	logger.Info("right")
+	if out := buf.String(); !strings.HasPrefix(out, " INFO[") {
+		t.Fatalf("unexpected right aligned output %q", out)
+	}
+}
+
+func TestRemapLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{RemapLevel: func(level Level) Level {
+		if level == WARN {
+			return INFO
+		}
+		return level
+	}})
+	logger.writer = &buf
+	logger.Warn("noisy")
+	logger.Log(WARN, "noisy log")
+	if out := buf.String(); !strings.HasPrefix(out, "INFO [") || strings.Contains(out, "WARN") || strings.Count(out, "\n") != 2 {
+		t.Fatalf("unexpected remapped output %q", out)
+	}
+
+	buf.Reset()
+	logger.SetLevel(WARN)
+	logger.Warn("hidden")
+	logger.Log(WARN, "hidden")
+	logger.Output(WARN, "hidden")
+	logger.Error("shown")
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.HasPrefix(out, "ERROR[") {
+		t.Fatalf("unexpected gating of remapped level %q", out)
+	}
+}
+
+func TestNameKey(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{NameKey: "component"})
+	logger.writer = &buf
+	logger.Named("db").With("a", 1).Info("query")
+	if out := buf.String(); !strings.HasSuffix(out, "] query\tcomponent=db\ta=1\n") {
+		t.Fatalf("unexpected text output %q", out)
+	}
+
+	buf.Reset()
+	logger = NewLogger(&LogConfig{Format: JSONFormat})
+	logger.writer = &buf
+	logger.Clock = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC) }
+	logger.Named("db").Info("query", "id", 1)
+	if out := buf.String(); out != `{"time":"2021-03-04T05:06:07Z","level":"INFO","msg":"query","logger":"db","id":1}`+"\n" {
+		t.Fatalf("unexpected json output %q", out)
+	}
+}
+
+func TestStackRateLimit(t *testing.T) {
+	MaxStacksPerSecond = 3
+	defer func() {
+		MaxStacksPerSecond = 0
+		stackLimiter = stackBucket{}
+	}()
+	stacks := 0
+	for i := 0; i < 50; i++ {
+		info := StackInfo(0, "flood", "i", i)
+		if !strings.Contains(info, "flood\ti=") {
+			t.Fatalf("missing message %q", info)
+		}
+		if !strings.HasSuffix(info, "(stack omitted, rate limited)\n") {
+			stacks++
+		}
+	}
+	if stacks < 3 || stacks > 4 {
+		t.Fatalf("expected stacks throttled to the burst, got %d", stacks)
+	}
+	stackLimiter.last = stackLimiter.last.Add(-time.Second)
+	if info := StackInfo(0, "later"); strings.HasSuffix(info, "rate limited)\n") {
+		t.Fatalf("expected stack after the bucket refilled %q", info)
+	}
+}
+
+func TestSetFilter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.SetFilter(func(level Level, msg string) bool { return level >= ERROR || !strings.Contains(msg, "healthz") })
+	logger.Info("GET /healthz")
+	logger.With("a", 1).Info("GET /api")
+	logger.Output(INFO, "raw /healthz")
+	logger.Error("GET /healthz failed")
+	expected := []string{"] GET /api\ta=1", "] GET /healthz failed"}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, expected[i]) {
+			t.Fatalf("unexpected line %q, expected suffix %q", line, expected[i])
+		}
+	}
+
+	buf.Reset()
+	logger.SetFilter(nil)
+	logger.Info("GET /healthz")
+	if buf.Len() == 0 {
+		t.Fatalf("expected nil filter to allow all messages")
+	}
+}
+
+func TestTimer(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	logger.Clock = func() time.Time { return now }
+	done := logger.Timer(INFO, "handled")
+	now = now.Add(1500 * time.Millisecond)
+	done("path", "/")
+	if out := buf.String(); !strings.HasSuffix(out, "] handled\tpath=/\ttook=1.5s\n") {
+		t.Fatalf("unexpected timer output %q", out)
+	}
+
+	buf.Reset()
+	logger = NewLogger(nil)
+	logger.writer = &buf
+	func() {
+		defer logger.Timer(WARN, "slow")()
+		time.Sleep(5 * time.Millisecond)
+	}()
+	out := buf.String()
+	i := strings.Index(out, "took=")
+	if i < 0 {
+		t.Fatalf("missing took field %q", out)
+	}
+	if took, err := time.ParseDuration(strings.TrimSpace(out[i+5:])); err != nil || took < 5*time.Millisecond || took > time.Second {
+		t.Fatalf("implausible duration %q", out)
+	}
+}
+
+func TestTimePrecision(t *testing.T) {
+	var buf bytes.Buffer
+	formats := map[string]int{"": 3, TimeFormatMicro: 6, TimeFormatNano: 9}
+	for format, digits := range formats {
+		logger := NewLogger(&LogConfig{TimeFormat: format})
+		logger.writer = &buf
+		logger.Clock = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 120000000, time.UTC) }
+		buf.Reset()
+		logger.Info("precise")
+		stamp := strings.TrimSuffix(strings.SplitN(buf.String(), "[", 2)[1], "] precise\n")
+		if fraction := stamp[strings.LastIndex(stamp, ".")+1:]; len(fraction) != digits || strings.Trim(fraction, "0") != "12" {
+			t.Fatalf("expected %d fractional digits, got %q", digits, stamp)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{})
+	logger.writer = &buf
+	logger.WriteJSON(DEBUG, map[string]interface{}{"skipped": true})
+	logger.WriteJSON(INFO, map[string]interface{}{"user": "alice", "level": "custom"})
+	logger.WriteJSON(WARN, map[string]interface{}{"count": 2})
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two records, got %q", buf.String())
+	}
+	for i, want := range []string{"INFO", "WARN"} {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i]), &record); err != nil {
+			t.Fatalf("invalid json line %q: %v", lines[i], err)
+		}
+		if record["level"] != want || record["time"] == nil {
+			t.Fatalf("unexpected record %q", lines[i])
+		}
+	}
+	if !strings.Contains(lines[0], `"fields.level":"custom"`) {
+		t.Fatalf("expected reserved key namespaced, got %q", lines[0])
+	}
+}
+
+func TestWriteJSONNamespaceCollision(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	logger.WriteJSON(INFO, map[string]interface{}{"level": "custom", "fields.level": "caller"})
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid json line %q: %v", buf.String(), err)
+	}
+	if record["level"] != "INFO" || record["fields.level"] != "caller" || record["fields.fields.level"] != "custom" {
+		t.Fatalf("expected no field lost, got %q", buf.String())
+	}
+}
+
+func TestJSONNamespaceCollision(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{Format: JSONFormat})
+	logger.writer = &buf
+	logger.Error("hello", "level", "x", "msg", "m2", "fields.level", "y")
+	logger.Group("msg").Info("grouped", "a", 1)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("invalid json line %q: %v", lines[0], err)
+	}
+	if record["level"] != "ERROR" || record["msg"] != "hello" || record["fields.msg"] != "m2" ||
+		record["fields.level"] != "y" || record["fields.fields.level"] != "x" {
+		t.Fatalf("expected record fields kept, got %q", lines[0])
+	}
+	record = nil
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("invalid json line %q: %v", lines[1], err)
+	}
+	if group, ok := record["fields.msg"].(map[string]interface{}); record["msg"] != "grouped" || !ok || group["a"] != 1.0 {
+		t.Fatalf("expected group namespaced, got %q", lines[1])
+	}
+}
+
+func TestMessageSeparator(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{MessageSeparator: " | "})
+	logger.writer = &buf
+	logger.Info("Done.", "a", 1, "b", 2)
+	if !strings.HasSuffix(buf.String(), "] Done. | a=1	b=2\n") {
+		t.Fatalf("unexpected line %q", buf.String())
+	}
+	buf.Reset()
+	logger.Info("Done.", "odd")
+	if !strings.HasSuffix(buf.String(), "] Done. | odd=\n") {
+		t.Fatalf("unexpected line %q", buf.String())
+	}
+}
+
+func TestLevelFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{LevelFields: map[Level][]interface{}{ERROR: {"alert", true}}})
+	logger.writer = &buf
+	logger.Warn("warned", "a", 1)
+	if strings.Contains(buf.String(), "alert") {
+		t.Fatalf("unexpected default on WARN line %q", buf.String())
+	}
+	logger.Error("failed", "a", 1)
+	if !strings.HasSuffix(buf.String(), "] failed	a=1	alert=true\n") {
+		t.Fatalf("expected default on ERROR line, got %q", buf.String())
+	}
+}
+
+func TestSinks(t *testing.T) {
+	var console, file bytes.Buffer
+	logger := NewLogger(&LogConfig{Sinks: []Sink{{Writer: &file, Format: JSONFormat}}})
+	logger.writer = &console
+	logger.Info("user login", "user", "alice")
+	if !strings.HasSuffix(console.String(), "] user login	user=alice\n") {
+		t.Fatalf("unexpected text line %q", console.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(file.Bytes(), &record); err != nil || record["msg"] != "user login" || record["user"] != "alice" {
+		t.Fatalf("unexpected json line %q, err %v", file.String(), err)
+	}
+	logger.Output(INFO, "raw")
+	if !strings.HasSuffix(file.String(), "\nraw\n") || !strings.HasSuffix(console.String(), "\nraw\n") {
+		t.Fatalf("expected raw line in both outputs, got %q and %q", console.String(), file.String())
+	}
+}
+
+type closeSyncWriter struct {
+	flushSyncWriter
+}
+
+func (w *closeSyncWriter) Close() error { w.calls = append(w.calls, "close"); return nil }
+
+func TestSinkBatchFlushAndClose(t *testing.T) {
+	main, sink := &recordWriter{}, &recordWriter{}
+	logger := NewLogger(&LogConfig{Sinks: []Sink{{Writer: sink, Format: TSVFormat}}})
+	logger.writer = main
+	logger.Batch(func(b *Batch) {
+		b.Info("first")
+		b.Output(INFO, "second")
+		if calls := sink.calls(); len(calls) != 0 {
+			t.Fatalf("expected no sink writes inside batch, got %q", calls)
+		}
+	})
+	if calls := main.calls(); len(calls) != 2 {
+		t.Fatalf("expected a main write of each line, got %q", calls)
+	}
+	calls := sink.calls()
+	if len(calls) != 2 || !strings.HasSuffix(calls[0], "\tfirst\t\n") || calls[1] != "second\n" {
+		t.Fatalf("expected a sink write of each line, got %q", calls)
+	}
+
+	kept, dropped := &closeSyncWriter{}, &closeSyncWriter{}
+	logger = NewLogger(&LogConfig{FlushLevel: ERROR, Sinks: []Sink{{Writer: kept}, {Writer: dropped}}})
+	logger.writer = &bytes.Buffer{}
+	logger.Error("failed")
+	if strings.Join(kept.calls, ",") != "flush,sync" {
+		t.Fatalf("expected sink flushed at FlushLevel, got %q", kept.calls)
+	}
+	kept.calls = nil
+	if err := logger.Flush(); err != nil || strings.Join(kept.calls, ",") != "flush,sync" {
+		t.Fatalf("expected sink flushed by Flush, got %q, err %v", kept.calls, err)
+	}
+	kept.calls, dropped.calls = nil, nil
+	if err := logger.Reconfigure(&LogConfig{Sinks: []Sink{{Writer: kept}}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(kept.calls) != 0 || strings.Join(dropped.calls, ",") != "flush,sync,close" {
+		t.Fatalf("expected only dropped sink closed, got %q and %q", kept.calls, dropped.calls)
+	}
+	defer SetRootForTest(logger)()
+	if err := Shutdown(context.Background()); err != nil || strings.Join(kept.calls, ",") != "flush,sync,close" {
+		t.Fatalf("expected sink closed by Shutdown, got %q, err %v", kept.calls, err)
+	}
+	written := kept.Len()
+	logger.Info("after shutdown")
+	if kept.Len() != written {
+		t.Fatalf("expected no sink writes after Shutdown, got %q", kept.String())
+	}
+}
+
+func TestSetLevelString(t *testing.T) {
+	logger := NewLogger(nil)
+	if err := logger.SetLevelString("warn"); err != nil || logger.Level() != WARN {
+		t.Fatalf("expected WARN level, got %v, err %v", logger.Level(), err)
+	}
+	if err := logger.SetLevelString("loud"); err == nil || logger.Level() != WARN {
+		t.Fatalf("expected error keeping WARN level, got %v, err %v", logger.Level(), err)
+	}
+	defer SetRootForTest(NewLogger(nil))()
+	if err := SetLevelString("DEBUG"); err != nil || Root.Level() != DEBUG {
+		t.Fatalf("expected DEBUG root level, got %v, err %v", Root.Level(), err)
+	}
+	if err := SetLevelString(""); err == nil || Root.Level() != DEBUG {
+		t.Fatalf("expected error keeping DEBUG root level, got %v, err %v", Root.Level(), err)
+	}
+}
+
+func TestParseLevelAlias(t *testing.T) {
+	for _, name := range []string{"VERBOSE", "verbose", "VERBO", "verbo"} {
+		if level, err := ParseLevelStrict(name); err != nil || level != VERBOSE {
+			t.Fatalf("expected VERBOSE for %q, got %v, err %v", name, level, err)
+		}
+	}
+	if level := ParseLevel("VERB"); level != INFO {
+		t.Fatalf("expected INFO for unknown level, got %v", level)
+	}
+}
+
+func TestPrintf(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	defer SetRootForTest(logger)()
+	Printf("%d items for %s: %v", 3, "alice", []int{1, 2})
+	if want := fmt.Sprintf("%d items for %s: %v", 3, "alice", []int{1, 2}) + "\n"; buf.String() != want {
+		t.Fatalf("expected %q, got %q", want, buf.String())
+	}
+	buf.Reset()
+	logger.Printf("done %q\n", "x")
+	if want := fmt.Sprintf("done %q\n", "x"); buf.String() != want {
+		t.Fatalf("expected %q, got %q", want, buf.String())
+	}
+	buf.Reset()
+	logger.SetLevel(WARN)
+	logger.Printf("hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("expected INFO message skipped, got %q", buf.String())
+	}
+}
+
+func TestOnce(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	for i := 0; i < 3; i++ {
+		logger.Once(WARN, "Deprecated option", "i", i)
+		logger.Named("child").Once(WARN, "Other call site", "i", i)
+	}
+	if lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"); len(lines) != 2 ||
+		!strings.HasSuffix(lines[0], "] Deprecated option	i=0") || !strings.HasSuffix(lines[1], "] Other call site	logger=child	i=0") {
+		t.Fatalf("expected a line of each call site, got %q", buf.String())
+	}
+
+	var other bytes.Buffer
+	for _, w := range []*bytes.Buffer{&buf, &other} {
+		l := NewLogger(nil)
+		l.writer = w
+		l.Once(WARN, "Shared call site")
+	}
+	if !strings.HasSuffix(buf.String(), "] Shared call site\n") || other.Len() != 0 {
+		t.Fatalf("expected a single line of the call site across loggers, got %q and %q", buf.String(), other.String())
+	}
+}
+
+func TestJSONStack(t *testing.T) {
+	var buf bytes.Buffer
+	exit = func(int) {}
+	defer func() { exit = os.Exit }()
+	logger := NewLogger(&LogConfig{Format: JSONFormat})
+	logger.writer = &buf
+	logger.Fatal("bad config", "a", 1)
+	var record struct {
+		Level string
+		Msg   string
+		A     int
+		Stack []map[string]interface{}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid json line %q: %v", buf.String(), err)
+	}
+	if record.Level != "FATAL" || record.Msg != "bad config" || record.A != 1 || len(record.Stack) == 0 {
+		t.Fatalf("unexpected record %q", buf.String())
+	}
+	frame := record.Stack[0]
+	if fn, _ := frame["func"].(string); !strings.HasSuffix(fn, ".TestJSONStack") || frame["line"] == nil ||
+		!strings.HasSuffix(fmt.Sprint(frame["file"]), "log_test.go") {
+		t.Fatalf("expected stack starting at the caller, got %v", record.Stack)
+	}
+}
+
+func BenchmarkWriteManyFields(b *testing.B) {
+	logger := NewLogger(nil)
+	logger.writer = io.Discard
+	args := make([]interface{}, 0, 40)
+	for i := 0; i < 20; i++ {
+		args = append(args, fmt.Sprintf("key%d", i), i)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Info("Many fields", args...)
+	}
+}
+
+func TestConcurrentFatal(t *testing.T) {
+	w := &recordWriter{}
+	logger := NewLogger(nil)
+	logger.writer = w
+	exited, release := make(chan int, 10), make(chan struct{})
+	exit = func(code int) {
+		exited <- code
+		<-release
+	}
+	defer func() { exit = os.Exit }()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger.Fatal("fatal error")
+		}()
+	}
+	<-exited
+	// Let the other fatal calls reach the guard before the first exit returns
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls := w.calls(); len(calls) != 1 || len(exited) != 0 || !strings.Contains(calls[0], "fatal error\n") {
+		t.Fatalf("expected a single fatal stack and exit, got %d exits after %q", len(exited)+1, calls)
+	}
+}
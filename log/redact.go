@@ -0,0 +1,124 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Placeholder of field values with a key listed in LogConfig.RedactKeys
+var RedactedKeyValue = "***"
+
+// Check if the last segment of the field key after any '.', e.g. of a flattened or grouped key, is listed in keys, ignoring case
+func redactedKey(keys []string, key string) bool {
+	key = key[strings.LastIndexByte(key, '.')+1:]
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy the field arguments with values of keys listed in keys replaced by RedactedKeyValue, including those of nested maps
+func redactFields(keys []string, args []interface{}) []interface{} {
+	redacted := make([]interface{}, len(args))
+	copy(redacted, args)
+	for i := 1; i < len(redacted); i += 2 {
+		key, ok := redacted[i-1].(groupKey)
+		if ok && redactedKey(keys, key.key) || !ok && redactedKey(keys, FormatValue(redacted[i-1])) {
+			redacted[i] = RedactedKeyValue
+		} else {
+			redacted[i] = redactValue(keys, redacted[i])
+		}
+	}
+	return redacted
+}
+
+// Copy a json record with values of keys listed in keys replaced by RedactedKeyValue, including those of nested maps
+func redactRecord(keys []string, record map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(record))
+	for key, value := range record {
+		if redactedKey(keys, key) {
+			value = RedactedKeyValue
+		} else {
+			value = redactValue(keys, value)
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// Copy a map[string]interface{} value with its redacted values, other values are returned as is
+func redactValue(keys []string, value interface{}) interface{} {
+	if m, ok := value.(map[string]interface{}); ok {
+		return redactRecord(keys, m)
+	}
+	return value
+}
+
+// Rewrite marshaled json with values of object keys listed in keys replaced by RedactedKeyValue at any depth,
+// keeping the key order, e.g. for Json and Dump of structs and maps
+func redactJSON(keys []string, data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var b bytes.Buffer
+	if err := redactJSONValue(keys, dec, &b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func redactJSONValue(keys []string, dec *json.Decoder, b *bytes.Buffer) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		data, err := json.Marshal(token)
+		b.Write(data)
+		return err
+	}
+	b.WriteByte(byte(delim))
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if delim == '[' {
+			if err := redactJSONValue(keys, dec, b); err != nil {
+				return err
+			}
+			continue
+		}
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		data, _ := json.Marshal(key)
+		b.Write(data)
+		b.WriteByte(':')
+		if !redactedKey(keys, key) {
+			if err := redactJSONValue(keys, dec, b); err != nil {
+				return err
+			}
+			continue
+		}
+		var skipped json.RawMessage
+		if err := dec.Decode(&skipped); err != nil {
+			return err
+		}
+		data, _ = json.Marshal(RedactedKeyValue)
+		b.Write(data)
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if delim == '{' {
+		b.WriteByte('}')
+	} else {
+		b.WriteByte(']')
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRedactKeys(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{RedactKeys: []string{"password", "token"}})
+	logger.writer = &buf
+	logger.Info("login", "user", "alice", "Password", []byte("secret"), "token", 42)
+	if !strings.HasSuffix(buf.String(), "] login	user=alice	Password=***	token=***\n") {
+		t.Fatalf("unexpected line %q", buf.String())
+	}
+	buf.Reset()
+	logger.Group("auth").Info("login", "password", "secret")
+	if !strings.HasSuffix(buf.String(), "] login	auth.password=***\n") {
+		t.Fatalf("unexpected grouped line %q", buf.String())
+	}
+
+	buf.Reset()
+	logger = NewLogger(&LogConfig{RedactKeys: []string{"password", "token"}, Format: JSONFormat})
+	logger.writer = &buf
+	logger.Info("login", "user", "alice", "password", "secret")
+	if !strings.Contains(buf.String(), `"user":"alice","password":"***"`) {
+		t.Fatalf("unexpected json line %q", buf.String())
+	}
+	buf.Reset()
+	logger.WriteJSON(INFO, map[string]interface{}{"user": "alice", "TOKEN": "secret"})
+	if !strings.Contains(buf.String(), `"TOKEN":"***","user":"alice"`) {
+		t.Fatalf("unexpected json record %q", buf.String())
+	}
+}
+
+func TestRedactNestedKeys(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{RedactKeys: []string{"password"}, FlattenMaps: true})
+	logger.writer = &buf
+	creds := map[string]interface{}{"user": "alice", "password": "secret", "db": map[string]interface{}{"password": "secret"}}
+	logger.Info("login", "creds", creds)
+	if !strings.HasSuffix(buf.String(), "] login	creds.db.password=***	creds.password=***	creds.user=alice\n") {
+		t.Fatalf("unexpected flattened line %q", buf.String())
+	}
+	buf.Reset()
+	logger = NewLogger(&LogConfig{RedactKeys: []string{"password"}})
+	logger.writer = &buf
+	logger.Info("login", "creds", creds)
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatalf("unexpected nested line %q", buf.String())
+	}
+
+	buf.Reset()
+	logger = NewLogger(&LogConfig{RedactKeys: []string{"password"}, FlattenMaps: true, Format: JSONFormat})
+	logger.writer = &buf
+	logger.Info("login", "creds", creds)
+	if !strings.Contains(buf.String(), `"creds":{"db":{"password":"***"},"password":"***","user":"alice"}`) {
+		t.Fatalf("unexpected json line %q", buf.String())
+	}
+	buf.Reset()
+	logger.WriteJSON(INFO, map[string]interface{}{"creds": creds})
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatalf("unexpected json record %q", buf.String())
+	}
+	if creds["password"] != "secret" {
+		t.Fatal("expected the logged map left unchanged")
+	}
+}
+
+func TestRedactJsonAndAudit(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{RedactKeys: []string{"password"}})
+	logger.writer = &buf
+	logger.Audit("bob", "login", "db", "ok", "password", "hunter2")
+	if out := buf.String(); strings.Contains(out, "hunter2") || !strings.Contains(out, `"password":"***"`) {
+		t.Fatalf("unexpected audit record %q", out)
+	}
+
+	buf.Reset()
+	logger.Json(INFO, map[string]string{"user": "bob", "password": "hunter2"})
+	if out := buf.String(); out != `{"password":"***","user":"bob"}`+"\n" {
+		t.Fatalf("unexpected json %q", out)
+	}
+	buf.Reset()
+	type account struct {
+		User  string
+		Login map[string]interface{}
+		Keys  []map[string]string
+	}
+	logger.Dump(INFO, account{User: "bob", Login: map[string]interface{}{"Password": "hunter2", "n": 1}, Keys: []map[string]string{{"password": "x"}}})
+	expected := "{\n  \"User\": \"bob\",\n  \"Login\": {\n    \"Password\": \"***\",\n    \"n\": 1\n  },\n  \"Keys\": [\n    {\n      \"password\": \"***\"\n    }\n  ]\n}\n"
+	if out := buf.String(); out != expected {
+		t.Fatalf("unexpected dump %q", out)
+	}
+	buf.Reset()
+	logger.Jsonw(INFO, "login", map[string]string{"password": "hunter2"})
+	if out := buf.String(); !strings.HasSuffix(out, "] login\tobj={\"password\":\"***\"}\n") {
+		t.Fatalf("unexpected jsonw line %q", out)
+	}
+}
@@ -1,17 +1,41 @@
 package log
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 // Default log file flag
 var LogFileFlag int = os.O_WRONLY|os.O_CREATE|os.O_APPEND
 
+// Max consecutive attempts of a write interrupted or making no progress
+const maxWriteRetries = 3
+
+// Attempts of uploading a rotated log file, and the delay before a retry which doubles each time
+var (
+	UploadRetries = 3
+	UploadBackoff = time.Second
+)
+
+// Max time Close waits for pending uploads, uploads still running afterwards are abandoned
+var UploadCloseTimeout = 30 * time.Second
+
+// Interval between attempts to open a log file which failed to open in LogConfig.Writer
+var ReconnectInterval = 10 * time.Second
+
+// Uploader ships rotated log files, e.g. to cloud object storage
+type Uploader interface {
+	Upload(path string) error
+}
+
 // Logger config
 type LogConfig struct {
 	// Logger level to use
@@ -19,6 +43,150 @@ type LogConfig struct {
 	MaxSize  uint   // max bytes in MB
 	MaxFiles uint   // max log files
 	Path     string // main log file path
+
+	// Output format of structured log lines, TextFormat by default
+	Format OutputFormat
+	// Optional hook rewriting the level of each call, e.g. WARN to INFO for noisy call sites.
+	// The remapped level is the one checked against the logger level and rendered.
+	RemapLevel func(Level) Level
+
+	// Time format of text and TSV lines, e.g. TimeFormatNano, TimeFormat by default
+	TimeFormat string
+
+	// Separator between the message and the first field of text lines, e.g. " | ", a tab by default like between fields
+	MessageSeparator string
+
+	// Rendering of the level token of text lines, LevelLeft by default
+	LevelFormat LevelFormat
+	// APP-NAME of SyslogFormat lines, the executable name by default
+	AppName string
+
+	// Tag structured log lines with host= and pid= fields
+	IncludeHost bool
+	IncludePID  bool
+
+	// Skip structured lines with neither message nor fields
+	SkipEmpty bool
+	// Placeholder used in place of an empty message, if not empty
+	EmptyMessage string
+
+	// Append a seq=N field to structured lines, counting from 1 for each process
+	Sequence bool
+
+	// Default fields appended to structured lines of exactly the level, e.g. {ERROR: {"alert", true}}
+	LevelFields map[Level][]interface{}
+
+	// Keys of fields with values masked by RedactedKeyValue in structured lines, WriteJSON, Json, Dump, Jsonw and Audit,
+	// ignoring case, e.g. password
+	RedactKeys []string
+
+	// Flatten map[string]interface{} field values into key.sub= fields in text and TSV lines
+	FlattenMaps bool
+
+	// Extra outputs of each line, each rendering structured lines in its own format, e.g. JSON into a file
+	// besides text on the console. Raw lines are written as is. The writers are flushed along with the logger writer,
+	// and closed by Shutdown and by Reconfigure unless the new config keeps them.
+	Sinks []Sink
+
+	// Separate log files of levels, e.g. {INFO: "info.log", ERROR: "error.log"}, rotated like Path.
+	// A line goes to the file of the highest level not above its level, lines below all of them go to Path.
+	LevelPaths map[Level]string
+
+	// Replace newlines within structured lines by NewlineToken, \n by default, keeping one line per entry
+	EscapeNewlines bool
+	NewlineToken   string
+
+	// Level from which lines are flushed through buffering writers once written, e.g. BatchWriter, see Logger.Flush.
+	// Lower levels stay buffered. TRACE, the zero value, disables flushing by level.
+	FlushLevel Level
+
+	// Max duration of a write into the output writer, e.g. a slow network sink, lines are dropped after it
+	WriteTimeout time.Duration
+
+	// Bytes of recent output kept in memory and dumped by Fatal and Recover, 0 to disable
+	CrashBuffer int
+
+	// File system of log files, the os file system if nil
+	FS FS
+
+	// Max fields of a structured line, extra fields are dropped and counted by a fields_truncated= field
+	MaxFields int
+
+	// Field key of the name of named loggers, logger by default
+	NameKey string
+
+	// Renamed keys of the time, level and msg fields of json records, e.g. {"msg": "message"}
+	JSONKeys map[string]string
+
+	// Optional header written at the top of each new log file, including after rotation, e.g. a UTF-8 BOM
+	Header func() []byte
+
+	// Optional uploader of rotated log files, which are only pruned by MaxFiles once uploaded,
+	// archives failing all the UploadRetries attempts are kept
+	Uploader Uploader
+
+	// Interval of a background sweeper gzipping rotated log files, disabled if zero.
+	// Compressing on a schedule rather than on rotation keeps CPU usage smooth under bursts of traffic.
+	CompressInterval time.Duration
+
+	// Log file to switch to when the disk of the main log file is full, usually on another volume
+	FallbackPath string
+
+	// Lines of source around the caller attached to ERROR and above structured lines as a source= field.
+	// Source files are read from disk, so it's meant for development builds only.
+	SourceContext int
+}
+
+// Extra output of log lines in its own output format
+type Sink struct {
+	Writer io.Writer
+	Format OutputFormat
+}
+
+// Get the extra outputs of log lines
+func (c *LogConfig) sinks() []Sink {
+	if c == nil {
+		return nil
+	}
+	return c.Sinks
+}
+
+// Get the default fields of lines at the level
+func (c *LogConfig) levelFields(level Level) []interface{} {
+	if c == nil {
+		return nil
+	}
+	return c.LevelFields[level]
+}
+
+// Log file of lines at a level and above, up to the next routed level
+type levelRoute struct {
+	level         Level
+	writer        io.Writer
+	headerWritten bool
+}
+
+// Create the level routes of LevelPaths ordered by level descending, sharing the rotation config.
+// The route writers are created by open, the ones created already are closed if it fails.
+func (c *LogConfig) levelRoutes(open func(LogConfig) (io.Writer, error)) (routes []*levelRoute, err error) {
+	if c == nil {
+		return
+	}
+	for level, path := range c.LevelPaths {
+		config := *c
+		config.Path = path
+		config.LevelPaths = nil
+		w, err := open(config)
+		if err != nil {
+			for _, route := range routes {
+				closeWriter(route.writer)
+			}
+			return nil, err
+		}
+		routes = append(routes, &levelRoute{level: level, writer: w})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].level > routes[j].level })
+	return
 }
 
 // Provide logger writer instance, nil config will use os.Stderr instead
@@ -29,14 +197,19 @@ func (c *LogConfig) Writer() io.Writer {
 	w, err := NewFileWriter(*c)
 	if err != nil {
 		fmt.Printf("Failed to create file writer, err %v\n", err)
-		return os.Stderr
+		var pathErr *os.PathError
+		if !errors.As(err, &pathErr) {
+			return os.Stderr
+		}
+		// The log file may become writable later, write to stderr until then
+		go w.reconnect()
 	}
 	return w
 }
 
 // Create a file writer instance with a log config
 func NewFileWriter(c LogConfig) (w *FileWriter, err error) {
-	w = &FileWriter{LogConfig: c}
+	w = &FileWriter{LogConfig: c, done: make(chan struct{})}
 	err = w.Init()
 	return
 }
@@ -45,8 +218,22 @@ func NewFileWriter(c LogConfig) (w *FileWriter, err error) {
 type FileWriter struct {
 	LogConfig     // Embed the config
 	size, maxSize int
-	file          *os.File
+	file          File
 	ch            chan bool
+	// Whether writes switched to FallbackPath after the disk became full
+	degraded bool
+	// Holds of rotation by Logger.Batch, size rotation is skipped while held
+	holds int
+	// Lock of writes and rotations
+	lock sync.Mutex
+	// Closed to stop reconnecting to the log file
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// Reference counts of files in use, e.g. being uploaded, skipped by pruning
+	inUse     map[string]int
+	inUseLock sync.Mutex
+	uploads   sync.WaitGroup
 }
 
 // Initiate a file writer instance
@@ -66,27 +253,160 @@ func (w *FileWriter) Init() (err error) {
 		}
 	}
 
-	w.file, err = openFile(w.Path)
-	if err == nil && w.MaxFiles > 0 {
+	w.file, err = w.openFile(w.Path)
+	if err == nil {
+		w.started()
+		w.opened()
+	}
+	if w.CompressInterval > 0 {
+		go w.sweep()
+	}
+	return
+}
+
+// Track the size of the newly opened log file, writing the Header into it if it's empty
+func (w *FileWriter) started() {
+	w.size = 0
+	if info, err := w.file.Stat(); err == nil {
+		w.size = int(info.Size())
+	}
+	if w.Header != nil && w.size == 0 {
+		if header := w.Header(); len(header) > 0 {
+			n, _ := writeFull(w.file, header)
+			w.size += n
+		}
+	}
+}
+
+// Start pruning stale log files once the log file is open
+func (w *FileWriter) opened() {
+	if w.MaxFiles > 0 {
 		w.ch = make(chan bool, 1)
 		w.ch <- true
 		go w.removeLogs()
 	}
-	return
+}
+
+// Keep trying to open the log file every ReconnectInterval until it's open or the writer is closed
+func (w *FileWriter) reconnect() {
+	ticker := time.NewTicker(ReconnectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+		f, err := w.openFile(w.Path)
+		if err != nil {
+			continue
+		}
+		w.lock.Lock()
+		w.file = f
+		w.started()
+		w.opened()
+		w.lock.Unlock()
+		fmt.Printf("Reconnected to log file, path: %s \n", w.Path)
+		return
+	}
+}
+
+// Check if the log file is not open yet, while writes go to stderr
+func (w *FileWriter) Reconnecting() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.file == nil
 }
 
 // Implement io.Writer interface for file writer
 func (w *FileWriter) Write(p []byte) (n int, err error) {
-	if w.maxSize > 0 && w.size+len(p) > w.maxSize {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return os.Stderr.Write(p)
+	}
+	if w.maxSize > 0 && w.size+len(p) > w.maxSize && !w.degraded && w.holds == 0 {
 		err = w.rotate()
 		if err != nil {
 			fmt.Printf("Failed to rotate log file, path: %s err: %v \n", w.Path, err)
 			return
 		}
 	}
-	n, err = w.file.Write(p)
-	if err == nil && w.maxSize > 0 {
-		w.size += len(p)
+	n, err = writeFull(w.file, p)
+	if errors.Is(err, syscall.ENOSPC) && w.FallbackPath != "" && !w.degraded {
+		if err = w.fallback(); err == nil {
+			var m int
+			m, err = writeFull(w.file, p[n:])
+			n += m
+		}
+	}
+	w.size += n
+	return
+}
+
+// Hold off size rotation until releaseRotation, so the next n bytes are written into the same file.
+// The file is rotated first if they don't fit in it.
+func (w *FileWriter) holdRotation(n int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file != nil && w.maxSize > 0 && w.size > 0 && w.size+n > w.maxSize && !w.degraded && w.holds == 0 {
+		if err := w.rotate(); err != nil {
+			fmt.Printf("Failed to rotate log file, path: %s err: %v \n", w.Path, err)
+		}
+	}
+	w.holds++
+}
+
+// Release a hold of rotation by holdRotation
+func (w *FileWriter) releaseRotation() {
+	w.lock.Lock()
+	w.holds--
+	w.lock.Unlock()
+}
+
+// Switch writes to the fallback log file, rotation is disabled from then on
+func (w *FileWriter) fallback() error {
+	f, err := w.openFile(w.FallbackPath)
+	if err != nil {
+		fmt.Printf("Failed to open fallback log file, path: %s err: %v \n", w.FallbackPath, err)
+		return err
+	}
+	fmt.Printf("Disk full, switching to fallback log file, path: %s \n", w.FallbackPath)
+	w.file.Close()
+	w.file = f
+	w.degraded = true
+	return nil
+}
+
+// Check if the writer switched to the fallback log file because the disk was full
+func (w *FileWriter) Degraded() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.degraded
+}
+
+// writeFull keeps writing on short writes and retries interrupted writes, returning on a real error only
+func writeFull(dst io.Writer, p []byte) (n int, err error) {
+	retries := 0
+	for n < len(p) {
+		var m int
+		m, err = dst.Write(p[n:])
+		n += m
+		if err != nil && !errors.Is(err, syscall.EINTR) {
+			return
+		}
+		if err == nil && m > 0 {
+			retries = 0
+			continue
+		}
+		retries++
+		if retries > maxWriteRetries {
+			if err == nil {
+				err = io.ErrShortWrite
+			}
+			return
+		}
+		err = nil
 	}
 	return
 }
@@ -96,16 +416,21 @@ func (w *FileWriter) removeLogs() {
 	base := filepath.Base(w.Path)
 	dir := filepath.Dir(w.Path)
 	for range w.ch {
-		list, err := os.ReadDir(dir)
-		count := uint(0)
-		if err == nil {
-			for idx := len(list) - 1; idx >= 0; idx-- {
-				name := list[idx].Name()
-				if list[idx].Type().IsRegular() && strings.HasPrefix(name, base) {
-					count++
-					if count > w.MaxFiles && name != base {
-						os.Remove(filepath.Join(dir, name))
-					}
+		w.removeStaleLogs(dir, base)
+	}
+}
+
+// Remove log files beyond MaxFiles, except the ones in use
+func (w *FileWriter) removeStaleLogs(dir, base string) {
+	list, err := w.fs().ReadDir(dir)
+	count := uint(0)
+	if err == nil {
+		for idx := len(list) - 1; idx >= 0; idx-- {
+			name := list[idx].Name()
+			if list[idx].Type().IsRegular() && strings.HasPrefix(name, base) {
+				count++
+				if count > w.MaxFiles && name != base && !w.InUse(filepath.Join(dir, name)) {
+					w.fs().Remove(filepath.Join(dir, name))
 				}
 			}
 		}
@@ -117,35 +442,190 @@ func (w *FileWriter) rotate() (err error) {
 	if w.file != nil {
 		w.file.Sync()
 		w.file.Close()
-		os.Rename(w.Path, fmt.Sprintf("%s%s", w.Path, time.Now().Format(time.RFC3339)))
-		if w.ch != nil {
-			select {
-			case w.ch <- true:
-			default:
-			}
+		archive := w.newArchiveName(time.Now())
+		if w.fs().Rename(w.Path, archive) == nil && w.Uploader != nil {
+			w.upload(archive)
 		}
+		w.prune()
 	}
-	w.file, err = openFile(w.Path)
+	w.file, err = w.openFile(w.Path)
 	if err == nil {
-		if info, err := w.file.Stat(); err == nil {
-			w.size = int(info.Size())
-		} else {
-			w.size = 0
-		}
+		w.started()
 	}
 	return
 }
 
-// Close will try to close the file object
+// ForceRotate archives the current log file regardless of its size, e.g. before archiving by operators
+func (w *FileWriter) ForceRotate() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.degraded {
+		return fmt.Errorf("log file rotation is disabled on fallback log file")
+	}
+	return w.rotate()
+}
+
+// Trigger a prune of stale log files if MaxFiles applies
+func (w *FileWriter) prune() {
+	if w.ch != nil {
+		select {
+		case w.ch <- true:
+		default:
+		}
+	}
+}
+
+// Upload a rotated file in background with retries, the file is pruned only after a successful upload.
+// Once all the attempts failed the file stays marked as in use, so MaxFiles keeps it for the life of the writer.
+func (w *FileWriter) upload(path string) {
+	w.Acquire(path)
+	w.uploads.Add(1)
+	retries, backoff := UploadRetries, UploadBackoff
+	go func() {
+		defer w.uploads.Done()
+		for i := 0; i < retries; i++ {
+			if i > 0 {
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+			err := w.Uploader.Upload(path)
+			if err == nil {
+				w.Release(path)
+				w.prune()
+				return
+			}
+			fmt.Printf("Failed to upload log file, path: %s err: %v \n", path, err)
+		}
+		fmt.Printf("Gave up uploading log file, kept locally, path: %s \n", path)
+	}()
+}
+
+// Acquire marks a log file as in use, e.g. while it's compressed, so MaxFiles pruning skips it until released
+func (w *FileWriter) Acquire(path string) {
+	w.inUseLock.Lock()
+	if w.inUse == nil {
+		w.inUse = make(map[string]int)
+	}
+	w.inUse[path]++
+	w.inUseLock.Unlock()
+}
+
+// Release a log file marked by Acquire
+func (w *FileWriter) Release(path string) {
+	w.inUseLock.Lock()
+	if w.inUse[path] > 1 {
+		w.inUse[path]--
+	} else {
+		delete(w.inUse, path)
+	}
+	w.inUseLock.Unlock()
+}
+
+// Check if a log file is marked as in use
+func (w *FileWriter) InUse(path string) bool {
+	w.inUseLock.Lock()
+	defer w.inUseLock.Unlock()
+	return w.inUse[path] > 0
+}
+
+// Time layout of archive names, RFC3339 with fixed width nanoseconds so archives sort by name in rotation order
+const archiveTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Name of the log file archived at time t
+func (w *FileWriter) archiveName(t time.Time) string {
+	return fmt.Sprintf("%s%s", w.Path, t.Format(archiveTimeFormat))
+}
+
+// Name of a new archive at time t, moved forward while taken by an archive or its compressed copy,
+// so quick successive rotations never rename over an archive
+func (w *FileWriter) newArchiveName(t time.Time) string {
+	for {
+		name := w.archiveName(t)
+		if _, err := w.fs().Stat(name); err != nil {
+			if _, err := w.fs().Stat(name + CompressSuffix); err != nil {
+				return name
+			}
+		}
+		t = t.Add(time.Nanosecond)
+	}
+}
+
+// SimulateRotation lists the log files which would be kept after writing totalBytes more bytes, without writing anything.
+// Archives are assumed to rotate one second apart from now and are listed oldest first, followed by the main log file.
+// Existing archives are not taken into account.
+func (w *FileWriter) SimulateRotation(totalBytes int) []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var archives []string
+	if w.maxSize > 0 {
+		now := time.Now()
+		size, remaining := w.size, totalBytes
+		for size+remaining > w.maxSize {
+			if fill := w.maxSize - size; fill > 0 {
+				remaining -= fill
+			}
+			size = 0
+			archives = append(archives, w.archiveName(now.Add(time.Duration(len(archives))*time.Second)))
+		}
+	}
+	if w.MaxFiles > 0 && uint(len(archives)) > w.MaxFiles {
+		archives = archives[uint(len(archives))-w.MaxFiles:]
+	}
+	return append(archives, w.Path)
+}
+
+// Size reports the bytes of the current log file, i.e. written since the last rotation
+func (w *FileWriter) Size() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.size
+}
+
+// BytesUntilRotate reports the bytes which can be written before the next rotation, -1 if MaxSize is not set
+func (w *FileWriter) BytesUntilRotate() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.maxSize <= 0 || w.degraded {
+		return -1
+	}
+	if w.size > w.maxSize {
+		return 0
+	}
+	return w.maxSize - w.size
+}
+
+// Sync commits the current log file to stable storage
+func (w *FileWriter) Sync() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Close will try to close the file object, after pending uploads are done or UploadCloseTimeout passed
 func (w *FileWriter) Close() (err error) {
+	uploaded := make(chan struct{})
+	go func() {
+		w.uploads.Wait()
+		close(uploaded)
+	}()
+	timer := time.NewTimer(UploadCloseTimeout)
+	select {
+	case <-uploaded:
+	case <-timer.C:
+		fmt.Printf("Gave up waiting for log file uploads, path: %s \n", w.Path)
+	}
+	timer.Stop()
+	if w.done != nil {
+		w.closeOnce.Do(func() { close(w.done) })
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
 	f := w.file
 	if f != nil {
 		return f.Close()
 	}
 	return nil
 }
-
-// openFile will try to open a log file with desired flags
-func openFile(path string) (f *os.File, err error) {
-	return os.OpenFile(path, LogFileFlag, 0664)
-}
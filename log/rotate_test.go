@@ -0,0 +1,477 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Writer accepting at most chunk bytes per call, failing with the queued errors first
+type flakyWriter struct {
+	bytes.Buffer
+	chunk  int
+	errors []error
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if len(w.errors) > 0 {
+		err := w.errors[0]
+		w.errors = w.errors[1:]
+		return 0, err
+	}
+	if len(p) > w.chunk {
+		p = p[:w.chunk]
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestWriteFull(t *testing.T) {
+	w := &flakyWriter{chunk: 3, errors: []error{syscall.EINTR}}
+	n, err := writeFull(w, []byte("short writes"))
+	if err != nil || n != 12 || w.String() != "short writes" {
+		t.Fatalf("unexpected write result n=%d err=%v data=%q", n, err, w.String())
+	}
+
+	w = &flakyWriter{chunk: 3, errors: []error{errors.New("broken")}}
+	if _, err = writeFull(w, []byte("xx")); err == nil || err.Error() != "broken" {
+		t.Fatalf("expected real error, got %v", err)
+	}
+
+	w = &flakyWriter{chunk: 0}
+	if _, err = writeFull(w, []byte("xx")); err != io.ErrShortWrite {
+		t.Fatalf("expected short write error, got %v", err)
+	}
+}
+
+func TestSimulateRotation(t *testing.T) {
+	path := t.TempDir() + "/sim"
+	w, err := NewFileWriter(LogConfig{Path: path, MaxSize: 1, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if files := w.SimulateRotation(1 << 20); len(files) != 1 || files[0] != path+".log" {
+		t.Fatalf("unexpected rotation of a write filling the file %q", files)
+	}
+	files := w.SimulateRotation(3<<20 + 1)
+	if len(files) != 3 || files[2] != path+".log" {
+		t.Fatalf("expected two archives kept and the main file, got %q", files)
+	}
+	for _, name := range files[:2] {
+		stamp := strings.TrimPrefix(name, path+".log")
+		if _, err := time.Parse(time.RFC3339, stamp); err != nil {
+			t.Fatalf("unexpected archive name %q", name)
+		}
+	}
+	if files[0] >= files[1] {
+		t.Fatalf("expected archives ordered oldest first, got %q", files)
+	}
+	if _, err := os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Fatalf("simulation should not create files")
+	}
+}
+
+// Uploader failing the first attempt and blocking until released
+type mockUploader struct {
+	sync.Mutex
+	attempts int
+	uploaded []string
+	release  chan bool
+}
+
+func (u *mockUploader) Upload(path string) error {
+	u.Lock()
+	u.attempts++
+	first := u.attempts == 1
+	u.Unlock()
+	if first {
+		return errors.New("transient")
+	}
+	<-u.release
+	u.Lock()
+	u.uploaded = append(u.uploaded, path)
+	u.Unlock()
+	return nil
+}
+
+func TestUploader(t *testing.T) {
+	defer func(d time.Duration) { UploadBackoff = d }(UploadBackoff)
+	UploadBackoff = time.Millisecond
+	dir := t.TempDir()
+	u := &mockUploader{release: make(chan bool)}
+	w, err := NewFileWriter(LogConfig{Path: filepath.Join(dir, "up"), MaxFiles: 1, Uploader: u})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A newer archive makes the rotated one subject to pruning
+	newer := w.Path + "2999-01-01T00:00:00Z"
+	os.WriteFile(newer, []byte("newer"), 0664)
+	w.maxSize = 8
+	w.Write([]byte("12345678"))
+	w.Write([]byte("rotated"))
+	archives, _ := filepath.Glob(w.Path + "2*")
+	if len(archives) != 2 {
+		t.Fatalf("expected rotated archive next to the newer one, got %q", archives)
+	}
+	archive := archives[0]
+	time.Sleep(20 * time.Millisecond)
+	if _, err := os.Stat(archive); err != nil {
+		t.Fatalf("archive pruned before upload: %v", err)
+	}
+	close(u.release)
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, err = os.Stat(archive); os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	w.Close()
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected uploaded archive to be pruned")
+	}
+	if len(u.uploaded) != 1 || u.uploaded[0] != archive || u.attempts != 2 {
+		t.Fatalf("unexpected uploads %q after %d attempts", u.uploaded, u.attempts)
+	}
+}
+
+// Uploader failing every attempt, or blocking on hang if set
+type failingUploader struct{ hang chan bool }
+
+func (u failingUploader) Upload(path string) error {
+	if u.hang != nil {
+		<-u.hang
+	}
+	return errors.New("unreachable")
+}
+
+func TestUploadGivesUp(t *testing.T) {
+	defer func(d time.Duration) { UploadBackoff = d }(UploadBackoff)
+	UploadBackoff = time.Millisecond
+	w, err := NewFileWriter(LogConfig{Path: filepath.Join(t.TempDir(), "up"), Uploader: failingUploader{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.maxSize = 8
+	w.Write([]byte("12345678"))
+	w.Write([]byte("rotated"))
+	w.Close()
+	archives, _ := filepath.Glob(w.Path + "2*")
+	if len(archives) != 1 || !w.InUse(archives[0]) {
+		t.Fatalf("expected archive kept after failed uploads, got %q", archives)
+	}
+	w.removeStaleLogs(filepath.Dir(w.Path), filepath.Base(w.Path))
+	if _, err := os.Stat(archives[0]); err != nil {
+		t.Fatalf("expected archive not pruned after failed uploads: %v", err)
+	}
+
+	defer func(d time.Duration) { UploadCloseTimeout = d }(UploadCloseTimeout)
+	UploadCloseTimeout = 20 * time.Millisecond
+	hang := make(chan bool)
+	defer close(hang)
+	w, err = NewFileWriter(LogConfig{Path: filepath.Join(t.TempDir(), "hang"), Uploader: failingUploader{hang: hang}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.maxSize = 8
+	w.Write([]byte("12345678"))
+	w.Write([]byte("rotated"))
+	closed := make(chan error)
+	go func() { closed <- w.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("expected Close to give up on a hanging upload")
+	}
+}
+
+func TestPruneSkipsInUse(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewFileWriter(LogConfig{Path: filepath.Join(dir, "prune")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.MaxFiles = 1
+	old := w.Path + "2000-01-01T00:00:00Z"
+	older := w.Path + "1999-01-01T00:00:00Z"
+	newest := w.Path + "2999-01-01T00:00:00Z"
+	for _, name := range []string{old, older, newest} {
+		os.WriteFile(name, nil, 0664)
+	}
+	w.Acquire(old)
+	w.Acquire(old)
+	w.Release(old)
+	w.removeStaleLogs(dir, filepath.Base(w.Path))
+	if _, err := os.Stat(old); err != nil {
+		t.Fatalf("file in use was pruned")
+	}
+	if _, err := os.Stat(older); !os.IsNotExist(err) {
+		t.Fatalf("expected stale file to be pruned")
+	}
+	if _, err := os.Stat(newest); err != nil {
+		t.Fatalf("newest archive was pruned")
+	}
+	w.Release(old)
+	w.removeStaleLogs(dir, filepath.Base(w.Path))
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("expected released file to be pruned")
+	}
+}
+
+// Log file failing writes as if the disk was full
+type fullFile struct{ *os.File }
+
+func (f fullFile) Write(p []byte) (int, error) { return 0, syscall.ENOSPC }
+
+func TestFallbackOnDiskFull(t *testing.T) {
+	dir := t.TempDir()
+	fallback := filepath.Join(dir, "fallback.log")
+	w, err := NewFileWriter(LogConfig{Path: filepath.Join(dir, "full"), FallbackPath: fallback})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.file = fullFile{w.file.(*os.File)}
+	if n, err := w.Write([]byte("critical\n")); err != nil || n != 9 {
+		t.Fatalf("unexpected write result %d %v", n, err)
+	}
+	if !w.Degraded() {
+		t.Fatalf("expected degraded state")
+	}
+	w.Write([]byte("more\n"))
+	w.Close()
+	if data, _ := os.ReadFile(fallback); string(data) != "critical\nmore\n" {
+		t.Fatalf("unexpected fallback content %q", data)
+	}
+}
+
+func TestForceRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "force")
+	logger := NewLogger(&LogConfig{Path: path})
+	w := logger.writer.(*FileWriter)
+	defer w.Close()
+	logger.Info("before")
+	if err := logger.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("after")
+	archives, _ := filepath.Glob(path + ".log?*")
+	if len(archives) != 1 {
+		t.Fatalf("expected one archive, got %q", archives)
+	}
+	if data, _ := os.ReadFile(archives[0]); !strings.Contains(string(data), "before") {
+		t.Fatalf("unexpected archive content %q", data)
+	}
+	if data, _ := os.ReadFile(path + ".log"); strings.Contains(string(data), "before") || !strings.Contains(string(data), "after") {
+		t.Fatalf("unexpected log file content %q", data)
+	}
+	if err := NewLogger(nil).Rotate(); err == nil {
+		t.Fatalf("expected rotation error of stderr logger")
+	}
+}
+
+func TestForceRotateTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "twice")
+	w, err := NewFileWriter(LogConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, line := range []string{"first", "second"} {
+		w.Write([]byte(line))
+		if err := w.ForceRotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archives, _ := filepath.Glob(w.Path + "?*")
+	if len(archives) != 2 {
+		t.Fatalf("expected two archives, got %q", archives)
+	}
+	for i, line := range []string{"first", "second"} {
+		if data, _ := os.ReadFile(archives[i]); string(data) != line {
+			t.Fatalf("unexpected archive %q content %q", archives[i], data)
+		}
+	}
+
+	now := time.Now()
+	name := w.newArchiveName(now)
+	os.WriteFile(name+CompressSuffix, nil, 0664)
+	if next := w.newArchiveName(now); next <= name {
+		t.Fatalf("expected a later archive name than the compressed %q, got %q", name, next)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	interval := ReconnectInterval
+	ReconnectInterval = 10 * time.Millisecond
+	defer func() { ReconnectInterval = interval }()
+	dir := filepath.Join(t.TempDir(), "later")
+	w, ok := (&LogConfig{Path: filepath.Join(dir, "app")}).Writer().(*FileWriter)
+	if !ok {
+		t.Fatalf("expected a reconnecting file writer")
+	}
+	defer w.Close()
+	if !w.Reconnecting() {
+		t.Fatalf("expected writer to be reconnecting")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for w.Reconnecting() {
+		if time.Now().After(deadline) {
+			t.Fatalf("writer did not switch to the log file")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	w.Write([]byte("reconnected\n"))
+	if data, _ := os.ReadFile(filepath.Join(dir, "app.log")); string(data) != "reconnected\n" {
+		t.Fatalf("unexpected log file content %q", data)
+	}
+}
+
+func TestLevelPaths(t *testing.T) {
+	dir := t.TempDir()
+	logger := NewLogger(&LogConfig{
+		Path:       filepath.Join(dir, "debug"),
+		LevelPaths: map[Level]string{INFO: filepath.Join(dir, "info"), ERROR: filepath.Join(dir, "error")},
+	})
+	logger.SetLevel(DEBUG)
+	logger.Debug("debug line")
+	logger.Info("info line")
+	logger.Warn("warn line")
+	logger.Error("error line")
+	logger.Output(ERROR, "raw error line")
+	expected := map[string][]string{
+		"debug.log": {"debug line"},
+		"info.log":  {"info line", "warn line"},
+		"error.log": {"error line", "raw error line"},
+	}
+	for name, lines := range expected {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		if len(out) != len(lines) {
+			t.Fatalf("unexpected %s content %q", name, data)
+		}
+		for i, line := range lines {
+			if !strings.HasSuffix(out[i], line) {
+				t.Fatalf("unexpected %s line %q, expected %q", name, out[i], line)
+			}
+		}
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	child := logger.Named("db")
+	logger.Info("to buffer")
+
+	path := filepath.Join(dir, "reload")
+	if err := logger.Reconfigure(&LogConfig{Path: path, Level: WARN}); err != nil {
+		t.Fatal(err)
+	}
+	w := logger.writer.(*FileWriter)
+	logger.Info("hidden")
+	logger.Warn("to file")
+	child.Warn("child to file")
+	if data, _ := os.ReadFile(path + ".log"); !strings.Contains(string(data), "] to file\n") || !strings.Contains(string(data), "child to file") || strings.Contains(string(data), "hidden") {
+		t.Fatalf("unexpected log file content %q", data)
+	}
+
+	if err := logger.Reconfigure(&LogConfig{Path: filepath.Join(dir, "missing", "x")}); err == nil {
+		t.Fatalf("expected error of unwritable path")
+	}
+	if logger.writer != w || logger.Level() != WARN {
+		t.Fatalf("expected logger unchanged after failed reconfigure")
+	}
+	if err := logger.Reconfigure(&LogConfig{Path: path, LevelPaths: map[Level]string{ERROR: filepath.Join(dir, "missing", "e")}}); err == nil {
+		t.Fatalf("expected error of unwritable level path")
+	}
+	if err := logger.Reconfigure(&LogConfig{Path: path, Level: Level(100)}); err == nil {
+		t.Fatalf("expected error of invalid level")
+	}
+	if logger.writer != w || logger.Level() != WARN {
+		t.Fatalf("expected logger unchanged after failed reconfigure")
+	}
+
+	if err := logger.Reconfigure(nil); err != nil {
+		t.Fatal(err)
+	}
+	if logger.writer != os.Stderr || logger.Level() != INFO {
+		t.Fatalf("expected stderr output at INFO level")
+	}
+	if _, err := w.Write([]byte("closed\n")); err == nil {
+		t.Fatalf("expected old writer to be closed")
+	}
+	if err := child.Reconfigure(nil); err == nil {
+		t.Fatalf("expected error reconfiguring a derived logger")
+	}
+}
+
+func TestSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "size")
+	w, err := NewFileWriter(LogConfig{Path: path, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("hello\n"))
+	if w.Size() != 6 || w.BytesUntilRotate() != 1<<20-6 {
+		t.Fatalf("unexpected size %d, until rotate %d", w.Size(), w.BytesUntilRotate())
+	}
+	w.Close()
+	w, err = NewFileWriter(LogConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("world\n"))
+	if w.Size() != 12 || w.BytesUntilRotate() != -1 {
+		t.Fatalf("expected size of reopened file, got %d, until rotate %d", w.Size(), w.BytesUntilRotate())
+	}
+	if err := w.ForceRotate(); err != nil || w.Size() != 0 {
+		t.Fatalf("expected size reset by rotation, got %d, err %v", w.Size(), err)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "header")
+	opened := 0
+	logger := NewLogger(&LogConfig{Path: path, Header: func() []byte {
+		opened++
+		return []byte(fmt.Sprintf("\xef\xbb\xbf# file %d\n", opened))
+	}})
+	w := logger.writer.(*FileWriter)
+	defer w.Close()
+	logger.Info("before")
+	if err := logger.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("after")
+	archives, _ := filepath.Glob(path + ".log?*")
+	if len(archives) != 1 {
+		t.Fatalf("expected one archive, got %q", archives)
+	}
+	if data, _ := os.ReadFile(archives[0]); !strings.HasPrefix(string(data), "\xef\xbb\xbf# file 1\nINFO ") {
+		t.Fatalf("unexpected archive content %q", data)
+	}
+	if data, _ := os.ReadFile(path + ".log"); !strings.HasPrefix(string(data), "\xef\xbb\xbf# file 2\nINFO ") {
+		t.Fatalf("unexpected log file content %q", data)
+	}
+}
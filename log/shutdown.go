@@ -0,0 +1,102 @@
+package log
+
+import (
+	"context"
+	"io"
+	"os"
+	"reflect"
+	"sync/atomic"
+)
+
+// Shutdown flushes and closes the writers of Root, including its level routes and sinks, bounded by ctx.
+// Lines logged afterwards go to stderr. Calling it again is a no-op until Root is initiated again.
+// If ctx is done while waiting for the writer lock, the writers are left open and a later Shutdown may close them,
+// writers already being closed when ctx is done are closed in the background.
+//
+//	defer log.Shutdown(ctx)
+func Shutdown(ctx context.Context) error {
+	root := Root
+	done := make(chan error, 1)
+	var abandoned int32
+	go func() { done <- root.shutdown(&abandoned) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		atomic.StoreInt32(&abandoned, 1)
+		return ctx.Err()
+	}
+}
+
+// Flush and close the writers of the logger once, unless abandoned is set when the writer lock is acquired
+func (l *Logger) shutdown(abandoned *int32) (err error) {
+	o := l.sink()
+	o.Lock()
+	defer o.Unlock()
+	if o.closed || atomic.LoadInt32(abandoned) == 1 {
+		return nil
+	}
+	o.closed = true
+	opts := *o.opts()
+	writers := append([]io.Writer{o.writer}, routeWriters(opts.routes)...)
+	writers = append(writers, sinkWriters(opts.config.sinks())...)
+	for _, route := range opts.routes {
+		route.writer = os.Stderr
+	}
+	o.writer = os.Stderr
+	if opts.config != nil && len(opts.config.Sinks) > 0 {
+		config := *opts.config
+		config.Sinks = nil
+		opts.config = &config
+		o.options.Store(&opts)
+	}
+	for _, w := range writers {
+		if e := closeWriter(w); err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// Flush and close a writer, except stdout and stderr
+func closeWriter(w io.Writer) (err error) {
+	err = flushWriter(w)
+	if w == os.Stdout || w == os.Stderr {
+		return
+	}
+	if c, ok := w.(io.Closer); ok {
+		if e := c.Close(); err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// Get the writers of level routes
+func routeWriters(routes []*levelRoute) (writers []io.Writer) {
+	for _, route := range routes {
+		writers = append(writers, route.writer)
+	}
+	return
+}
+
+// Get the writers of sinks
+func sinkWriters(sinks []Sink) (writers []io.Writer) {
+	for _, sink := range sinks {
+		writers = append(writers, sink.Writer)
+	}
+	return
+}
+
+// Check if w is one of writers, writers of non comparable types are never found
+func containsWriter(writers []io.Writer, w io.Writer) bool {
+	if w == nil || !reflect.TypeOf(w).Comparable() {
+		return false
+	}
+	for _, writer := range writers {
+		if writer == w {
+			return true
+		}
+	}
+	return false
+}
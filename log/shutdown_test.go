@@ -0,0 +1,63 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// Writer counting flushes and closes
+type closeWriterMock struct {
+	bytes.Buffer
+	flushes, closes int
+}
+
+func (w *closeWriterMock) Flush() error { w.flushes++; return nil }
+func (w *closeWriterMock) Close() error { w.closes++; return nil }
+
+func TestShutdown(t *testing.T) {
+	w := &closeWriterMock{}
+	logger := NewLogger(nil)
+	logger.writer = w
+	defer SetRootForTest(logger)()
+	Root.Named("db").Info("before shutdown")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if w.flushes != 1 || w.closes != 1 || w.Len() == 0 {
+		t.Fatalf("expected writer flushed and closed once, got %d %d", w.flushes, w.closes)
+	}
+	if err := Shutdown(ctx); err != nil || w.flushes != 1 || w.closes != 1 {
+		t.Fatalf("expected second shutdown to be a no-op, got %v %d %d", err, w.flushes, w.closes)
+	}
+	if Root.writer != os.Stderr {
+		t.Fatalf("expected stderr output after shutdown")
+	}
+
+	// Shutdown is bounded by the context, leaving the writers open
+	w = &closeWriterMock{}
+	logger = NewLogger(nil)
+	logger.writer = w
+	defer SetRootForTest(logger)()
+	Root.Lock()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := Shutdown(ctx); err != context.DeadlineExceeded {
+		Root.Unlock()
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	Root.Unlock()
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	Root.Lock()
+	defer Root.Unlock()
+	if w.closes != 1 || Root.writer != os.Stderr {
+		t.Fatalf("expected writer closed once by the later shutdown, got %d", w.closes)
+	}
+}
@@ -0,0 +1,86 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Largest source file read for source context, bigger files are skipped
+const maxSourceSize = 1 << 20
+
+var (
+	// Directory of the logger package, frames inside it are not the caller
+	packageDir string
+
+	// Lines of source files read for source context, nil if the file is not readable
+	sourceCache sync.Map
+)
+
+func init() {
+	if _, file, _, ok := runtime.Caller(0); ok {
+		packageDir = filepath.Dir(file)
+	}
+}
+
+// Find the file and line of the first caller outside of the logger package
+func callerLine() (string, int, bool) {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if frame.File != "" && (filepath.Dir(frame.File) != packageDir || strings.HasSuffix(frame.File, "_test.go")) {
+			return frame.File, frame.Line, true
+		}
+		if !more {
+			return "", 0, false
+		}
+	}
+}
+
+// Read the lines of a regular source file once, nil if it is missing, too big or not readable
+func sourceLines(file string) []string {
+	if v, ok := sourceCache.Load(file); ok {
+		return v.([]string)
+	}
+	var lines []string
+	if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() && info.Size() <= maxSourceSize {
+		if data, err := os.ReadFile(file); err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+	}
+	sourceCache.Store(file, lines)
+	return lines
+}
+
+// Render n lines of source around the caller line, marked with >, empty if the source is not available
+func sourceContext(n int) string {
+	file, line, ok := callerLine()
+	if !ok {
+		return ""
+	}
+	lines := sourceLines(file)
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	start, end := line-n, line+n
+	if start < 1 {
+		start = 1
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:%d", file, line)
+	for i := start; i <= end; i++ {
+		mark := " "
+		if i == line {
+			mark = ">"
+		}
+		fmt.Fprintf(&b, "\n%s%5d| %s", mark, i, lines[i-1])
+	}
+	return b.String()
+}
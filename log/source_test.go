@@ -0,0 +1,29 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSourceContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{SourceContext: 1})
+	logger.writer = &buf
+	logger.Warn("no source")
+	if out := buf.String(); strings.Contains(out, "source=") {
+		t.Fatalf("unexpected source for warn %q", out)
+	}
+	buf.Reset()
+	logger.Error("broken", "k", 1) // source marker
+	out := buf.String()
+	if !strings.Contains(out, "\tk=1\tsource=") || !strings.Contains(out, "source_test.go:") {
+		t.Fatalf("missing source context %q", out)
+	}
+	if !strings.Contains(out, `>`) || !strings.Contains(out, `logger.Error("broken", "k", 1) // source marker`) {
+		t.Fatalf("missing caller line %q", out)
+	}
+	if !strings.Contains(out, "buf.Reset()") || strings.Contains(out, `logger.Warn("no source")`) {
+		t.Fatalf("unexpected context lines %q", out)
+	}
+}
@@ -0,0 +1,32 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSyslogFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&LogConfig{Format: SyslogFormat, AppName: "my app"})
+	logger.writer = &buf
+	logger.Clock = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 8000, time.UTC) }
+	logger.Warn("disk low", "free", "1 GB", "path", `C:\"x"]`)
+	header := regexp.MustCompile(`^<12>1 2021-03-04T05:06:07\.000008Z \S+ my_app ` + strconv.Itoa(os.Getpid()) + ` - `)
+	out := buf.String()
+	if !header.MatchString(out) {
+		t.Fatalf("invalid syslog header %q", out)
+	}
+	if rest := header.ReplaceAllString(out, ""); rest != `[fields@32473 free="1 GB" path="C:\\\"x\"\]"] disk low`+"\n" {
+		t.Fatalf("unexpected structured data and message %q", rest)
+	}
+
+	buf.Reset()
+	logger.Error("failed")
+	if out := buf.String(); !regexp.MustCompile(`^<11>1 \S+ \S+ my_app \d+ - - failed\n$`).MatchString(out) {
+		t.Fatalf("unexpected syslog line without fields %q", out)
+	}
+}
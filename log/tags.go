@@ -0,0 +1,267 @@
+package log
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Placeholder of struct fields tagged with log:"redact" in Json and Dump
+var RedactedValue = "[REDACTED]"
+
+// Types with log tags, directly or in nested struct fields and elements
+var taggedTypes sync.Map
+
+// Rewrite a struct value, or a slice, array or map of structs, honoring log:"hex" and log:"redact" field tags,
+// other values are returned as is
+func applyLogTags(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	for i := 0; i < maxDerefDepth && v.Kind() == reflect.Ptr && !v.IsNil(); i++ {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if hasLogTags(v.Type(), 0) {
+			return taggedStruct{v}
+		}
+	case reflect.Slice, reflect.Map:
+		if !v.IsNil() && hasLogTags(v.Type(), 0) {
+			return taggedElems(v)
+		}
+	case reflect.Array:
+		if hasLogTags(v.Type(), 0) {
+			return taggedElems(v)
+		}
+	}
+	return value
+}
+
+// Copy the elements of a slice or array into a []interface{}, or the values of a map into a map of the same key type,
+// with log tags applied to each element
+func taggedElems(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Map {
+		var elem interface{}
+		m := reflect.MakeMapWithSize(reflect.MapOf(v.Type().Key(), reflect.TypeOf(&elem).Elem()), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem = applyLogTags(iter.Value().Interface())
+			m.SetMapIndex(iter.Key(), reflect.ValueOf(&elem).Elem())
+		}
+		return m.Interface()
+	}
+	elems := make([]interface{}, v.Len())
+	for i := range elems {
+		elems[i] = applyLogTags(v.Index(i).Interface())
+	}
+	return elems
+}
+
+// Parsed log struct tag: an optional field name followed by hex and redact options, e.g. log:"token,redact"
+type logTag struct {
+	name        string
+	hex, redact bool
+}
+
+func parseLogTag(tag string) (t logTag) {
+	for i, part := range strings.Split(tag, ",") {
+		switch part {
+		case "hex":
+			t.hex = true
+		case "redact":
+			t.redact = true
+		default:
+			if i == 0 {
+				t.name = part
+			}
+		}
+	}
+	return
+}
+
+// Check if the struct type, or the element type of a slice, array or map, has log tags.
+// Nested struct fields and element types are checked up to maxDerefDepth levels.
+func hasLogTags(t reflect.Type, depth int) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return depth < maxDerefDepth && hasLogTags(t.Elem(), depth+1)
+	case reflect.Struct:
+	default:
+		return false
+	}
+	if cached, ok := taggedTypes.Load(t); ok {
+		return cached.(bool)
+	}
+	tagged := false
+	for i := 0; i < t.NumField() && !tagged; i++ {
+		field := t.Field(i)
+		if field.Tag.Get("log") != "" {
+			tagged = true
+			break
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if depth < maxDerefDepth && ft != t {
+			tagged = hasLogTags(ft, depth+1)
+		}
+	}
+	if depth == 0 {
+		taggedTypes.Store(t, tagged)
+	}
+	return tagged
+}
+
+// Struct marshaled field by field in declaration order, following json tags
+type taggedStruct struct {
+	value reflect.Value
+}
+
+func (s taggedStruct) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	if err := s.encodeFields(&b, s.value); err != nil {
+		return nil, err
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func (s taggedStruct) encodeFields(b *bytes.Buffer, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		fv := v.Field(i)
+		if field.Anonymous && name == "" {
+			ft := fv
+			if ft.Kind() == reflect.Ptr {
+				if ft.IsNil() {
+					continue
+				}
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if err := s.encodeFields(b, ft); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() || !fv.CanInterface() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(","+opts+",", ",omitempty,") && fv.IsZero() {
+			continue
+		}
+		var value interface{}
+		if tag := parseLogTag(field.Tag.Get("log")); tag.redact {
+			value = RedactedValue
+		} else if tag.hex {
+			value = hexValue(fv)
+		} else {
+			value = applyLogTags(fv.Interface())
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(data)
+	}
+	return nil
+}
+
+// Render a field tagged with log:"hex", bytes and strings are hex encoded, integers rendered as 0x prefixed hex
+func hexValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return fmt.Sprintf("%#x", v.Interface())
+	case reflect.String:
+		return hex.EncodeToString([]byte(v.String()))
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return hex.EncodeToString(data)
+		}
+	}
+	return fmt.Sprintf("%x", v.Interface())
+}
+
+// Infos outputs an INFO log with the exported fields of a struct as key=value fields, e.g. a config or a request.
+// Fields are named by the log tag, which also accepts the hex and redact options, log:"-" skips a field.
+func (l *Logger) Infos(msg string, v interface{}) {
+	if level := l.remap(INFO); level >= l.Level() {
+		l.write(level, msg, structFields(v)...)
+	}
+}
+
+// Key value pairs of the exported fields of a struct, a non struct value is returned as a value= field
+func structFields(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	for i := 0; i < maxDerefDepth && rv.Kind() == reflect.Ptr && !rv.IsNil(); i++ {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return []interface{}{"value", v}
+	}
+	return appendStructFields(nil, rv, 0)
+}
+
+func appendStructFields(fields []interface{}, v reflect.Value, depth int) []interface{} {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := parseLogTag(field.Tag.Get("log"))
+		if tag.name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if field.Anonymous && tag.name == "" && depth < maxDerefDepth {
+			if fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				fields = appendStructFields(fields, fv, depth+1)
+				continue
+			}
+		}
+		if !field.IsExported() || !fv.CanInterface() {
+			continue
+		}
+		name := tag.name
+		if name == "" {
+			name = field.Name
+		}
+		var value interface{}
+		if tag.redact {
+			value = RedactedValue
+		} else if tag.hex {
+			value = hexValue(fv)
+		} else {
+			value = fv.Interface()
+		}
+		fields = append(fields, name, value)
+	}
+	return fields
+}
@@ -0,0 +1,117 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type tagAuth struct {
+	User     string
+	Password string `log:"redact"`
+}
+
+type tagPacket struct {
+	ID      uint32 `json:"id" log:"hex"`
+	Payload []byte `log:"hex"`
+	Note    string `json:"note,omitempty"`
+	Skipped string `json:"-"`
+	Auth    *tagAuth
+	tagAuth
+}
+
+func TestLogTags(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	packet := &tagPacket{
+		ID:      255,
+		Payload: []byte{0xca, 0xfe},
+		Skipped: "x",
+		Auth:    &tagAuth{User: "bob", Password: "secret"},
+		tagAuth: tagAuth{User: "alice", Password: "hidden"},
+	}
+	logger.Json(INFO, packet)
+	expected := `{"id":"0xff","Payload":"cafe","Auth":{"User":"bob","Password":"[REDACTED]"},"User":"alice","Password":"[REDACTED]"}` + "\n"
+	if out := buf.String(); out != expected {
+		t.Fatalf("unexpected json %q", out)
+	}
+
+	buf.Reset()
+	logger.Dump(INFO, tagAuth{User: "bob", Password: "secret"})
+	if out := buf.String(); out != "{\n  \"User\": \"bob\",\n  \"Password\": \"[REDACTED]\"\n}\n" {
+		t.Fatalf("unexpected dump %q", out)
+	}
+
+	buf.Reset()
+	logger.Json(INFO, struct{ A int }{1})
+	if out := buf.String(); out != `{"A":1}`+"\n" || strings.Contains(out, "REDACTED") {
+		t.Fatalf("unexpected json of untagged struct %q", out)
+	}
+}
+
+type tagConfig struct {
+	Host    string `log:"host"`
+	Port    int
+	Token   string `log:"token,redact"`
+	Key     []byte `log:",hex"`
+	Skipped bool   `log:"-"`
+	secret  string
+	tagAuth
+}
+
+func TestInfos(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	config := &tagConfig{Host: "db", Port: 5432, Token: "t", Key: []byte{1, 2}, secret: "s", tagAuth: tagAuth{"bob", "pw"}}
+	logger.Infos("config", config)
+	if out := buf.String(); !strings.HasSuffix(out, "] config\thost=db\tPort=5432\ttoken=[REDACTED]\tKey=0102\tUser=bob\tPassword=[REDACTED]\n") {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	buf.Reset()
+	logger.SetLevel(WARN)
+	logger.Infos("hidden", config)
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected output below level %q", buf.String())
+	}
+}
+
+type tagAccounts struct {
+	Users  []tagAuth
+	Admins map[string]*tagAuth
+	Root   [1]tagAuth
+}
+
+func TestLogTagsInElements(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	accounts := tagAccounts{
+		Users:  []tagAuth{{"a", "secret"}},
+		Admins: map[string]*tagAuth{"b": {"b", "secret"}},
+		Root:   [1]tagAuth{{"root", "secret"}},
+	}
+	logger.Json(INFO, accounts)
+	expected := `{"Users":[{"User":"a","Password":"[REDACTED]"}],"Admins":{"b":{"User":"b","Password":"[REDACTED]"}},"Root":[{"User":"root","Password":"[REDACTED]"}]}` + "\n"
+	if out := buf.String(); out != expected {
+		t.Fatalf("unexpected json %q", out)
+	}
+
+	buf.Reset()
+	logger.Json(INFO, []tagAuth{{"a", "secret"}})
+	if out := buf.String(); out != `[{"User":"a","Password":"[REDACTED]"}]`+"\n" {
+		t.Fatalf("unexpected json of slice %q", out)
+	}
+	buf.Reset()
+	logger.Dump(INFO, map[int]tagAuth{1: {"a", "secret"}})
+	if out := buf.String(); strings.Contains(out, "secret") || !strings.Contains(out, `"1": {`) {
+		t.Fatalf("unexpected dump of map %q", out)
+	}
+	buf.Reset()
+	logger.Json(INFO, tagAccounts{})
+	if out := buf.String(); out != `{"Users":null,"Admins":null,"Root":[{"User":"","Password":"[REDACTED]"}]}`+"\n" {
+		t.Fatalf("unexpected json of empty elements %q", out)
+	}
+}
@@ -0,0 +1,51 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+)
+
+// Writer sending complete lines to the test log
+type tbWriter struct {
+	tb  testing.TB
+	buf []byte
+	sync.Mutex
+}
+
+// Create a writer logging each line through tb.Log, so the output is attributed to the test
+// and only shown by go test on failure or with -v
+func NewTBWriter(tb testing.TB) io.Writer {
+	return &tbWriter{tb: tb}
+}
+
+// Implement io.Writer interface, a trailing partial line is kept until its newline arrives
+func (w *tbWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	w.tb.Helper()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.tb.Log(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// SetRootForTest installs l as Root, together with the package level handles, until restore is called:
+//
+//	defer log.SetRootForTest(logger)()
+func SetRootForTest(l *Logger) (restore func()) {
+	root := Root
+	Root = l
+	applyGlobalHanldes()
+	return func() {
+		Root = root
+		applyGlobalHanldes()
+	}
+}
@@ -0,0 +1,86 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TB recording its log, methods other than Helper and Log are not implemented
+type fakeTB struct {
+	testing.TB
+	lines []string
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Log(args ...interface{}) { tb.lines = append(tb.lines, fmt.Sprint(args...)) }
+
+func TestTBWriter(t *testing.T) {
+	tb := &fakeTB{}
+	w := NewTBWriter(tb)
+	w.Write([]byte("first\nsec"))
+	w.Write([]byte("ond"))
+	if len(tb.lines) != 1 || tb.lines[0] != "first" {
+		t.Fatalf("unexpected lines %q", tb.lines)
+	}
+	w.Write([]byte("\n"))
+	if len(tb.lines) != 2 || tb.lines[1] != "second" {
+		t.Fatalf("unexpected lines %q", tb.lines)
+	}
+}
+
+// Run by TestTBWriterFailureOnly in a child test binary, failing if TB_WRITER_HELPER=fail
+func TestTBWriterHelper(t *testing.T) {
+	mode := os.Getenv("TB_WRITER_HELPER")
+	if mode == "" {
+		t.Skip("run by TestTBWriterFailureOnly")
+	}
+	logger := NewLogger(nil)
+	logger.writer = NewTBWriter(t)
+	logger.Info("Shown only when the test fails", "case", "a")
+	logger.Output(INFO, "multi\nline")
+	if mode == "fail" {
+		t.Fail()
+	}
+}
+
+// Logs of the code under test are attributed to the test and only printed by go test on failure
+func TestTBWriterFailureOnly(t *testing.T) {
+	for _, mode := range []string{"pass", "fail"} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestTBWriterHelper$")
+		cmd.Env = append(os.Environ(), "TB_WRITER_HELPER="+mode)
+		out, err := cmd.CombinedOutput()
+		if (mode == "fail") != (err != nil) {
+			t.Fatalf("unexpected result %v of the %s test, output %q", err, mode, out)
+		}
+		shown := strings.Contains(string(out), "] Shown only when the test fails\tcase=a") &&
+			strings.Contains(string(out), ": multi\n") && strings.Contains(string(out), ": line\n")
+		if shown != (mode == "fail") {
+			t.Fatalf("expected the lines shown only by the failed test, %s test printed %q", mode, out)
+		}
+	}
+}
+
+func TestSetRootForTest(t *testing.T) {
+	var buf bytes.Buffer
+	root := Root
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	restore := SetRootForTest(logger)
+	Info("captured", "a", 1)
+	restore()
+	if out := buf.String(); !strings.HasSuffix(out, "] captured\ta=1\n") {
+		t.Fatalf("unexpected captured output %q", out)
+	}
+	if Root != root {
+		t.Fatalf("expected Root restored")
+	}
+	Info("not captured")
+	if strings.Contains(buf.String(), "not captured") {
+		t.Fatalf("unexpected capture after restore")
+	}
+}
@@ -0,0 +1,104 @@
+package log
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Max number of durations sampled by Timings to estimate percentiles, percentiles are not logged if not positive
+var TimingSamples = 256
+
+// Timings aggregates durations of a named operation and logs a summary of them at INFO,
+// with count, min, max and avg fields plus p50 and p95 estimated from a reservoir of samples.
+type Timings struct {
+	logger *Logger
+	name   string
+	done   chan struct{}
+	stop   sync.Once
+
+	lock            sync.Mutex
+	count           int
+	min, max, total time.Duration
+	samples         []time.Duration
+}
+
+// Create timings of an operation logging a summary every interval, summaries are only logged by Log if interval is not positive.
+// The timings are reset after each summary, Stop stops the periodic summaries.
+func (l *Logger) Timings(name string, interval time.Duration) *Timings {
+	t := &Timings{logger: l, name: name, done: make(chan struct{})}
+	if interval > 0 {
+		go t.run(interval)
+	}
+	return t
+}
+
+func (t *Timings) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			t.Log()
+		}
+	}
+}
+
+// Record a duration of the operation
+func (t *Timings) Record(d time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.count == 0 || d < t.min {
+		t.min = d
+	}
+	if d > t.max {
+		t.max = d
+	}
+	t.count++
+	t.total += d
+	// Reservoir sampling keeps each duration with the same probability
+	if len(t.samples) < TimingSamples {
+		t.samples = append(t.samples, d)
+	} else if i := rand.Intn(t.count); i < len(t.samples) {
+		t.samples[i] = d
+	}
+}
+
+// Start timing the operation, the returned closure records the time since Start:
+//
+//	defer timings.Start()()
+func (t *Timings) Start() func() {
+	start := t.logger.Clock()
+	return func() { t.Record(t.logger.Clock().Sub(start)) }
+}
+
+// Log the summary of the recorded durations and reset them, nothing is logged if none was recorded
+func (t *Timings) Log() {
+	t.lock.Lock()
+	count, min, max, total, samples := t.count, t.min, t.max, t.total, t.samples
+	t.count, t.min, t.max, t.total, t.samples = 0, 0, 0, 0, nil
+	t.lock.Unlock()
+	if count == 0 {
+		return
+	}
+	args := []interface{}{"count", count, "min", min, "max", max, "avg", total / time.Duration(count)}
+	// No percentiles without samples, e.g. with TimingSamples disabled
+	if len(samples) > 0 {
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		args = append(args, "p50", percentile(samples, 50), "p95", percentile(samples, 95))
+	}
+	t.logger.Info(t.name, args...)
+}
+
+// Stop the periodic summaries
+func (t *Timings) Stop() {
+	t.stop.Do(func() { close(t.done) })
+}
+
+// Nearest rank percentile of sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	return sorted[(p*len(sorted)+99)/100-1]
+}
@@ -0,0 +1,60 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimings(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	timings := logger.Timings("query", 0)
+	defer timings.Stop()
+	for i := 100; i > 0; i-- {
+		timings.Record(time.Duration(i) * time.Millisecond)
+	}
+	timings.Log()
+	if !strings.HasSuffix(buf.String(), "] query	count=100	min=1ms	max=100ms	avg=50.5ms	p50=50ms	p95=95ms\n") {
+		t.Fatalf("unexpected summary %q", buf.String())
+	}
+	buf.Reset()
+	timings.Log()
+	if buf.Len() != 0 {
+		t.Fatalf("expected no summary after reset, got %q", buf.String())
+	}
+}
+
+func TestTimingsInterval(t *testing.T) {
+	w := &recordWriter{}
+	logger := NewLogger(nil)
+	logger.writer = w
+	timings := logger.Timings("query", 5*time.Millisecond)
+	defer timings.Stop()
+	timings.Record(time.Second)
+	var out string
+	for i := 0; i < 100 && out == ""; i++ {
+		time.Sleep(5 * time.Millisecond)
+		out = strings.Join(w.calls(), "")
+	}
+	if !strings.Contains(out, "] query	count=1	min=1s	max=1s	avg=1s	p50=1s	p95=1s\n") {
+		t.Fatalf("expected periodic summary, got %q", out)
+	}
+}
+
+func TestTimingsWithoutSamples(t *testing.T) {
+	defer func(samples int) { TimingSamples = samples }(TimingSamples)
+	TimingSamples = 0
+	var buf bytes.Buffer
+	logger := NewLogger(nil)
+	logger.writer = &buf
+	timings := logger.Timings("query", 0)
+	defer timings.Stop()
+	timings.Record(time.Second)
+	timings.Log()
+	if !strings.HasSuffix(buf.String(), "] query	count=1	min=1s	max=1s	avg=1s\n") {
+		t.Fatalf("unexpected summary %q", buf.String())
+	}
+}